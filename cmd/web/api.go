@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/fayazp088/snippet-box/internal/search"
+	"github.com/julienschmidt/httprouter"
+)
+
+// snippetResponse is the JSON representation of a snippet returned by the API.
+// Its ID is the snippet's slug; numeric IDs are kept internal. The content of
+// a snippet protected by a passphrase is left out of lists, and only
+// included when the snippet is fetched by itself and the client has unlocked
+// it.
+type snippetResponse struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	Protected bool   `json:"protected"`
+	Language  string `json:"language"`
+	// LanguageConfidence is omitted when the author chose the language.
+	LanguageConfidence float64 `json:"language_confidence,omitempty"`
+	Visibility         string  `json:"visibility"`
+	// BurnAfterReading snippets are deleted when first read, which only a
+	// browser can do.
+	BurnAfterReading bool `json:"burn_after_reading"`
+	// Encrypted snippets hold content encrypted by the client, with a key
+	// the server never sees.
+	Encrypted bool `json:"encrypted"`
+	// URL is the path of the snippet's page.
+	URL     string    `json:"url"`
+	Author  string    `json:"author"`
+	UserID  int       `json:"user_id"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	Expires time.Time `json:"expires"`
+	Tags    []string  `json:"tags,omitempty"`
+}
+
+func newSnippetResponse(s models.Snippet) snippetResponse {
+	resp := snippetResponse{
+		ID:        s.Key(),
+		Title:     s.Title,
+		Content:   s.Content,
+		Protected: s.Protected(),
+		Language:  s.Language,
+
+		LanguageConfidence: s.LanguageConfidence,
+		Visibility:         s.Visibility,
+		BurnAfterReading:   s.BurnAfterReading,
+		Encrypted:          s.Encrypted,
+		URL:                "/snippet/view/" + s.Key(),
+		Author:             s.Author,
+		UserID:             s.UserID,
+		Created:            s.Created,
+		Updated:            s.Updated,
+		Expires:            s.Expires,
+		Tags:               s.Tags,
+	}
+
+	if resp.Protected {
+		resp.Content = ""
+	}
+
+	return resp
+}
+
+// unlockedSnippetResponse is newSnippetResponse for a snippet the client has
+// been allowed to see the content of, protected or not.
+func unlockedSnippetResponse(s models.Snippet) snippetResponse {
+	resp := newSnippetResponse(s)
+	resp.Content = s.Content
+	return resp
+}
+
+// searchResultResponse is the JSON representation of a search match. The
+// excerpt is split into fragments, with the matched terms flagged, so that
+// clients can highlight them without parsing markup.
+type searchResultResponse struct {
+	snippetResponse
+	Score   float64           `json:"score"`
+	Excerpt []search.Fragment `json:"excerpt"`
+}
+
+// paginationMetadata describes where a page of results sits in the full list.
+type paginationMetadata struct {
+	Page      int `json:"page"`
+	PageSize  int `json:"page_size"`
+	Total     int `json:"total"`
+	FirstPage int `json:"first_page"`
+	LastPage  int `json:"last_page"`
+}
+
+func newPaginationMetadata(page, pageSize, total int) paginationMetadata {
+	return paginationMetadata{
+		Page:      page,
+		PageSize:  pageSize,
+		Total:     total,
+		FirstPage: 1,
+		LastPage:  max((total+pageSize-1)/pageSize, 1),
+	}
+}
+
+// The apiError helper sends a JSON error response of the form
+// {"error": message}. Validation failures instead use apiFailedValidation so
+// that clients get the same per-field messages the HTML forms show.
+func (app *Application) apiError(w http.ResponseWriter, r *http.Request, status int, message any) {
+	err := app.writeJSON(w, status, map[string]any{"error": message}, nil)
+	if err != nil {
+		app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (app *Application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.apiError(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+func (app *Application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiError(w, r, http.StatusNotFound, "the requested resource could not be found")
+}
+
+func (app *Application) apiBadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	app.apiError(w, r, http.StatusBadRequest, err.Error())
+}
+
+func (app *Application) apiFailedValidation(w http.ResponseWriter, r *http.Request, fieldErrors map[string]string) {
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"errors": fieldErrors}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+// requireAPIAuthentication is the API counterpart of requireAuthentication:
+// rather than redirecting to the login page it responds with 401.
+func (app *Application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiError(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticateToken resolves an "Authorization: Bearer" API token to the user
+// who owns it, so that the rest of the API treats the request exactly as if
+// that user had logged in. Requests without the header fall through to the
+// session-based authenticate middleware.
+func (app *Application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		plaintext, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || plaintext == "" {
+			app.apiInvalidToken(w, r)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.apiInvalidToken(w, r)
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, token.UserID)
+		ctx = context.WithValue(ctx, tokenScopeContextKey, token.Scope)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *Application) apiInvalidToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	app.apiError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+}
+
+// requireWriteScope rejects requests authenticated with a read-only API token.
+// Requests authenticated by session cookie are not restricted.
+func (app *Application) requireWriteScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope, ok := r.Context().Value(tokenScopeContextKey).(string)
+		if ok && scope != models.ScopeWrite {
+			app.apiError(w, r, http.StatusForbidden, "this token does not have the write scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiSnippetFromParams loads the snippet named by the :id route parameter. If
+// it cannot be found, a JSON 404 response has already been sent and ok is
+// false, as it is after a 410 response for snippets burned after reading. The
+// content of a protected snippet may still be locked; see apiRequireUnlocked.
+func (app *Application) apiSnippetFromParams(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	snippet, err := app.lookupSnippet(r, params.ByName("id"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if !snippet.Burned.IsZero() {
+		app.apiError(w, r, http.StatusGone, fmt.Sprintf("this snippet was read at %s and has been deleted", snippet.Burned.Format(time.RFC3339)))
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// apiRequireUnlocked is the API counterpart of requireUnlocked, sending a
+// JSON error if the client may not see the snippet's content.
+func (app *Application) apiRequireUnlocked(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (ok bool) {
+	err := app.checkUnlocked(r, snippet)
+	if err == nil {
+		if snippet.Protected() {
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+		return true
+	}
+
+	status := unlockStatus(w, err)
+	if status == 0 {
+		app.apiServerError(w, r, err)
+		return false
+	}
+
+	app.apiError(w, r, status, err.Error())
+	return false
+}
+
+// apiSnippetForModification is like apiSnippetFromParams but also checks that
+// the current user may modify the snippet, responding with 403 if not.
+func (app *Application) apiSnippetForModification(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	snippet, ok = app.apiSnippetFromParams(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	canModify, err := app.canModify(r, snippet)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return models.Snippet{}, false
+	}
+
+	if !canModify {
+		app.apiError(w, r, http.StatusForbidden, "you do not have permission to modify this snippet")
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+func (app *Application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize := 20
+
+	if v := query.Get("page_size"); v != "" {
+		var err error
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 || pageSize > 100 {
+			app.apiFailedValidation(w, r, map[string]string{"page_size": "This field must be between 1 and 100"})
+			return
+		}
+	}
+
+	var form snippetListForm
+	err := app.formDecoder.Decode(&form, query)
+	if err != nil {
+		app.apiFailedValidation(w, r, map[string]string{"page": "This field must be a positive integer"})
+		return
+	}
+
+	opts := form.listOptions(pageSize)
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.FieldErrors)
+		return
+	}
+
+	snippets, total, err := app.snippets.List(opts)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	resp := make([]snippetResponse, 0, len(snippets))
+	for _, s := range snippets {
+		resp = append(resp, newSnippetResponse(s))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{
+		"snippets": resp,
+		"metadata": newPaginationMetadata(opts.Page, opts.PageSize, total),
+	}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *Application) apiSnippetSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize := 20
+
+	if v := query.Get("page_size"); v != "" {
+		var err error
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 || pageSize > 100 {
+			app.apiFailedValidation(w, r, map[string]string{"page_size": "This field must be between 1 and 100"})
+			return
+		}
+	}
+
+	var form searchForm
+	err := app.formDecoder.Decode(&form, query)
+	if err != nil {
+		app.apiFailedValidation(w, r, map[string]string{"page": "This field must be a positive integer"})
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.FieldErrors)
+		return
+	}
+
+	results, total, err := app.search.Search(form.Q, form.Page, pageSize)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	resp := make([]searchResultResponse, 0, len(results))
+	for _, r := range newSearchResults(results, form.Q) {
+		resp = append(resp, searchResultResponse{
+			snippetResponse: newSnippetResponse(r.Snippet),
+			Score:           r.Score,
+			Excerpt:         r.Excerpt,
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{
+		"results":  resp,
+		"metadata": newPaginationMetadata(form.Page, pageSize, total),
+	}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *Application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippetFromParams(w, r)
+	if !ok || !app.apiRequireUnlocked(w, r, snippet) {
+		return
+	}
+
+	required, err := app.burnConfirmationRequired(r, snippet)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if required {
+		app.apiError(w, r, http.StatusConflict, burnConfirmationMessage(r, snippet))
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippet": unlockedSnippetResponse(snippet)}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *Application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	form.validate()
+
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.FieldErrors)
+		return
+	}
+
+	id, err := app.snippets.Insert(app.authenticatedUserID(r), form.input())
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id, app.authenticatedUserID(r))
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", "/api/v1/snippets/"+snippet.Key())
+
+	err = app.writeJSON(w, http.StatusCreated, map[string]any{"snippet": unlockedSnippetResponse(snippet)}, headers)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *Application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.apiBadRequest(w, r, err)
+		return
+	}
+
+	// Leave the visibility alone unless the client sets it, so that an
+	// update can't publish an unlisted or private snippet by accident.
+	if form.Visibility == "" {
+		form.Visibility = snippet.Visibility
+	}
+
+	// A snippet stays encrypted, or not, for life. Leaving out expires
+	// keeps the current expiry.
+	form.Encrypted = snippet.Encrypted
+	form.editing = true
+
+	form.validate()
+
+	if !form.Valid() {
+		app.apiFailedValidation(w, r, form.FieldErrors)
+		return
+	}
+
+	err = app.snippets.Update(snippet.ID, app.authenticatedUserID(r), form.input())
+	if err == nil && form.RemovePassphrase {
+		err = app.snippets.SetPassphrase(snippet.ID, "")
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	// Reload the snippet as its author, who can see it whatever its new
+	// visibility.
+	snippet, err = app.snippets.Get(snippet.ID, snippet.UserID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, map[string]any{"snippet": unlockedSnippetResponse(snippet)}, nil)
+	if err != nil {
+		app.apiServerError(w, r, err)
+	}
+}
+
+func (app *Application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.apiSnippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiNotFound(w, r)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+func TestTokenScopes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := newTestUser(t, app, "alice@example.com")
+
+	readToken, err := app.tokens.Insert(userID, "read", models.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToken, err := app.tokens.Insert(userID, "write", models.ScopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokedToken, err := app.tokens.Insert(userID, "revoked", models.ScopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := app.tokens.ForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range tokens {
+		if token.Name == "revoked" {
+			if err := app.tokens.Revoke(token.ID, userID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	const body = `{"title": "Hello", "content": "Hello", "expires": 7}`
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		token    string
+		wantCode int
+	}{
+		{"Read token lists", http.MethodGet, "/api/v1/snippets", "", readToken, http.StatusOK},
+		{"Read token gets", http.MethodGet, "/api/v1/snippets/%s", "", readToken, http.StatusOK},
+		{"Read token creates", http.MethodPost, "/api/v1/snippets", body, readToken, http.StatusForbidden},
+		{"Read token updates", http.MethodPut, "/api/v1/snippets/%s", body, readToken, http.StatusForbidden},
+		{"Read token deletes", http.MethodDelete, "/api/v1/snippets/%s", "", readToken, http.StatusForbidden},
+		{"Read token pastes", http.MethodPost, "/", "Hello", readToken, http.StatusForbidden},
+		{"Write token creates", http.MethodPost, "/api/v1/snippets", body, writeToken, http.StatusCreated},
+		{"Write token updates", http.MethodPut, "/api/v1/snippets/%s", body, writeToken, http.StatusOK},
+		{"Write token deletes", http.MethodDelete, "/api/v1/snippets/%s", "", writeToken, http.StatusNoContent},
+		{"Write token pastes", http.MethodPost, "/", "Hello", writeToken, http.StatusCreated},
+		{"Revoked token", http.MethodGet, "/api/v1/snippets", "", revokedToken, http.StatusUnauthorized},
+		{"Unknown token", http.MethodPost, "/api/v1/snippets", body, "not-a-token", http.StatusUnauthorized},
+		{"No token creates", http.MethodPost, "/api/v1/snippets", body, "", http.StatusUnauthorized},
+		{"No token pastes", http.MethodPost, "/", "Hello", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := app.snippets.Insert(userID, models.SnippetInput{
+				Title:      "Mine",
+				Content:    "Mine",
+				Visibility: models.VisibilityPublic,
+				Expires:    7,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			snippet, err := app.snippets.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := tt.path
+			if strings.Contains(path, "%s") {
+				path = fmt.Sprintf(path, snippet.Key())
+			}
+
+			req, err := http.NewRequest(tt.method, ts.URL+path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.method != http.MethodGet && tt.path != "/" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			code, _, body := ts.do(t, req)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+}
+
+func TestAPISnippetCreateEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	userID := newTestUser(t, app, "alice@example.com")
+	token, err := app.tokens.Insert(userID, "write", models.ScopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+	}{
+		{"Ciphertext", "v1:AAECAwQFBgcICQoL:3q2-7w_mYWJjZGVmZ2hpams", http.StatusCreated},
+		{"Plain text", "echo hello", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"title": "Encrypted", "content": %q, "encrypted": true, "expires": 7}`, tt.content)
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snippets", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			code, _, body := ts.do(t, req)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d: %s", code, tt.wantCode, body)
+			}
+			if code == http.StatusUnprocessableEntity && !strings.Contains(body, "This field must be encrypted content") {
+				t.Errorf("got body %s; want the content field error", body)
+			}
+		})
+	}
+}
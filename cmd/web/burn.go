@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// burnConfirmationRequired reports whether the current user must confirm
+// before reading the snippet's content, because reading it will delete it.
+// Authors and admins can read burn-after-reading snippets as often as they
+// like.
+func (app *Application) burnConfirmationRequired(r *http.Request, snippet models.Snippet) (bool, error) {
+	if !snippet.BurnAfterReading {
+		return false, nil
+	}
+
+	canModify, err := app.canModify(r, snippet)
+	if err != nil {
+		return false, err
+	}
+
+	return !canModify, nil
+}
+
+// burnConfirmationMessage tells clients that can't show the confirmation page
+// where to read a burn-after-reading snippet instead.
+func burnConfirmationMessage(r *http.Request, snippet models.Snippet) string {
+	return fmt.Sprintf("this snippet is deleted once it is read; open %s in a browser to read it",
+		absoluteURL(r, "/snippet/view/"+snippet.Key()))
+}
+
+// requireBurnConfirmed stops anyone but its author reading a burn-after-reading
+// snippet with a GET request, which link previews and other bots make for
+// every URL they see. Browsers are shown a page that reads the snippet with a
+// POST to snippetBurnPost instead; other clients get a 409 plain text error.
+// In both cases ok is false.
+func (app *Application) requireBurnConfirmed(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (ok bool) {
+	required, err := app.burnConfirmationRequired(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return false
+	}
+	if !required {
+		return true
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	if !acceptsHTML(r) {
+		http.Error(w, burnConfirmationMessage(r, snippet), http.StatusConflict)
+		return false
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	app.render(w, r, http.StatusOK, "burn.gohtml", data)
+
+	return false
+}
+
+// snippetBurned responds to a request for a snippet that has been burned,
+// saying when it was read.
+func (app *Application) snippetBurned(w http.ResponseWriter, r *http.Request, snippet models.Snippet) {
+	if !acceptsHTML(r) {
+		http.Error(w, fmt.Sprintf("this snippet was read at %s and has been deleted", snippet.Burned.Format(time.RFC3339)), http.StatusGone)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	app.render(w, r, http.StatusGone, "burned.gohtml", data)
+}
+
+// snippetBurnPost shows a burn-after-reading snippet for the first and last
+// time, deleting it as it does.
+func (a *Application) snippetBurnPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) {
+		return
+	}
+
+	required, err := a.burnConfirmationRequired(r, snippet)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	// There's nothing to confirm for other snippets, or for authors.
+	if !required {
+		http.Redirect(w, r, "/snippet/view/"+snippet.Key(), http.StatusSeeOther)
+		return
+	}
+
+	burned, err := a.snippets.Burn(snippet.ID)
+	if err != nil {
+		// Someone else read it first; the snippet page now says when.
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/snippet/view/"+snippet.Key(), http.StatusSeeOther)
+			return
+		}
+		a.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := a.newTemplateData(r)
+	data.Snippet = burned
+	data.BurnedNow = true
+	a.render(w, r, http.StatusOK, "view.gohtml", data)
+}
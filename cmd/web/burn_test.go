@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+func TestSnippetBurnPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	author := ts.newSession(t)
+	authorID := author.login(t, app, "alice@example.com")
+
+	id, err := app.snippets.Insert(authorID, models.SnippetInput{
+		Title:            "Secret",
+		Content:          "Burn me",
+		Visibility:       models.VisibilityUnlisted,
+		Expires:          7,
+		BurnAfterReading: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := app.snippets.Get(id, authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewPath := "/snippet/view/" + snippet.Key()
+	burnPath := "/snippet/burn/" + snippet.Key()
+
+	first, second := ts.newSession(t), ts.newSession(t)
+
+	getHTML := func(t *testing.T, client *testServer) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+viewPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", "text/html")
+
+		code, _, body := client.do(t, req)
+		return code, body
+	}
+
+	burn := func(t *testing.T, client *testServer) (int, http.Header, string) {
+		t.Helper()
+
+		form := url.Values{}
+		form.Add("csrf_token", client.csrfToken(t, "/user/login"))
+
+		return client.postForm(t, burnPath, form)
+	}
+
+	// Both readers open the link before either confirms.
+	for _, client := range []*testServer{first, second} {
+		code, body := getHTML(t, client)
+		if code != http.StatusOK || strings.Contains(body, "Burn me") {
+			t.Fatalf("got status %d with content shown %t; want the confirmation page", code, strings.Contains(body, "Burn me"))
+		}
+	}
+
+	// The author can read it as often as they like without burning it.
+	if code, _, body := author.get(t, viewPath); code != http.StatusOK || !strings.Contains(body, "Burn me") {
+		t.Fatalf("author: got status %d; want %d and the content", code, http.StatusOK)
+	}
+
+	code, _, body := burn(t, first)
+	if code != http.StatusOK || !strings.Contains(body, "Burn me") {
+		t.Fatalf("first reader: got status %d; want %d and the content", code, http.StatusOK)
+	}
+
+	// The second reader is told when it was read.
+	code, _, body = burn(t, second)
+	if code != http.StatusGone || strings.Contains(body, "Burn me") {
+		t.Errorf("second reader: got status %d with content shown %t; want %d and no content", code, strings.Contains(body, "Burn me"), http.StatusGone)
+	}
+}
+
+// burnedFirstStore simulates another reader burning a snippet just before
+// Burn is called.
+type burnedFirstStore struct {
+	models.SnippetStore
+}
+
+func (s burnedFirstStore) Burn(id int) (models.Snippet, error) {
+	if _, err := s.SnippetStore.Burn(id); err != nil {
+		return models.Snippet{}, err
+	}
+	return s.SnippetStore.Burn(id)
+}
+
+func TestSnippetBurnPostRace(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	authorID := newTestUser(t, app, "alice@example.com")
+
+	id, err := app.snippets.Insert(authorID, models.SnippetInput{
+		Title:            "Secret",
+		Content:          "Burn me",
+		Visibility:       models.VisibilityUnlisted,
+		Expires:          7,
+		BurnAfterReading: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := app.snippets.Get(id, authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.snippets = burnedFirstStore{app.snippets}
+
+	viewPath := "/snippet/view/" + snippet.Key()
+
+	form := url.Values{}
+	form.Add("csrf_token", ts.csrfToken(t, "/user/login"))
+
+	// The loser is sent to the snippet's page, which says when it was read.
+	code, header, body := ts.postForm(t, "/snippet/burn/"+snippet.Key(), form)
+	if code != http.StatusSeeOther || header.Get("Location") != viewPath {
+		t.Fatalf("got status %d and Location %q; want %d and %q", code, header.Get("Location"), http.StatusSeeOther, viewPath)
+	}
+	if strings.Contains(body, "Burn me") {
+		t.Error("got the content shown")
+	}
+
+	if code, _, _ = ts.get(t, viewPath); code != http.StatusGone {
+		t.Errorf("got status %d following the redirect; want %d", code, http.StatusGone)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+type contextKey string
+
+const (
+	isAuthenticatedContextKey     = contextKey("isAuthenticated")
+	authenticatedUserIDContextKey = contextKey("authenticatedUserID")
+	tokenScopeContextKey          = contextKey("tokenScope")
+	csrfTokenContextKey           = contextKey("csrfToken")
+)
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/alexedwards/scs/mysqlstore"
+	"github.com/fayazp088/snippet-box/internal/envelope"
+	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/fayazp088/snippet-box/internal/models/memory"
+	"github.com/fayazp088/snippet-box/internal/search"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// defaultDSNs are used when no -dsn flag is given for a driver.
+var defaultDSNs = map[string]string{
+	"mysql":  "admin:admin@/snippets?parseTime=true",
+	"sqlite": "file:snippetbox.db?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate",
+}
+
+// openDatabase opens the SQL database for the mysql or sqlite driver, using
+// the default DSN for the driver if dsn is empty.
+func openDatabase(driver, dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		dsn = defaultDSNs[driver]
+	}
+
+	switch driver {
+	case "mysql":
+		return OpenDB("mysql", dsn)
+	case "sqlite":
+		return OpenDB("sqlite3", dsn)
+	default:
+		return nil, fmt.Errorf("the %q driver does not use a SQL database", driver)
+	}
+}
+
+// openStores connects the application to the storage backend named by driver
+// ("mysql", "sqlite" or "memory") and returns a function that releases it.
+// MySQL also keeps sessions in the database; the other backends keep them in
+// memory. MySQL answers searches with its FULLTEXT index; the other backends
+// use an in-process search index built at startup. If autoMigrate is set,
+// pending schema migrations are applied first. New snippets get slugs of
+// slugLength characters, and snippets saved before snippets had slugs are
+// given one at startup. If keys is not nil, snippet content is encrypted in
+// SQL databases, and MySQL searches with the in-process index too, as its
+// FULLTEXT index can't see encrypted content.
+func (app *Application) openStores(driver, dsn string, autoMigrate bool, slugLength int, keys *envelope.Keyring) (func() error, error) {
+	switch driver {
+	case "mysql", "sqlite":
+		db, err := openDatabase(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		if autoMigrate {
+			if err = app.migrateUp(db, driver); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+
+		snippets := &models.SnippetModel{DB: db, SlugLength: slugLength, Keys: keys, Logger: app.logger}
+
+		n, err := snippets.AssignSlugs()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if n > 0 {
+			app.logger.Info("assigned slugs to existing snippets", "count", n)
+		}
+
+		app.snippets = snippets
+
+		if driver == "mysql" {
+			app.sessionManager.Store = mysqlstore.New(db)
+		}
+
+		if driver == "mysql" && keys == nil {
+			app.search = &models.SearchModel{DB: db}
+		} else {
+			indexed, err := search.NewIndexedStore(app.snippets)
+			if err != nil {
+				db.Close()
+				return nil, err
+			}
+			app.snippets = indexed
+			app.search = indexed
+		}
+
+		app.users = &models.UserModel{DB: db}
+		app.revisions = &models.RevisionModel{DB: db, Keys: keys}
+		app.tags = &models.TagModel{DB: db}
+		app.tokens = &models.TokenModel{DB: db}
+
+		return db.Close, nil
+	case "memory":
+		db := memory.New()
+
+		indexed, err := search.NewIndexedStore(&memory.SnippetModel{DB: db, SlugLength: slugLength})
+		if err != nil {
+			return nil, err
+		}
+
+		app.snippets = indexed
+		app.search = indexed
+		app.users = &memory.UserModel{DB: db}
+		app.revisions = &memory.RevisionModel{DB: db}
+		app.tags = &memory.TagModel{DB: db}
+		app.tokens = &memory.TokenModel{DB: db}
+
+		return func() error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (want mysql, sqlite or memory)", driver)
+	}
+}
+
+func OpenDB(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -1,21 +1,214 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fayazp088/snippet-box/internal/diff"
+	"github.com/fayazp088/snippet-box/internal/highlight"
 	"github.com/fayazp088/snippet-box/internal/models"
 	"github.com/fayazp088/snippet-box/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
+// maxContentBytes limits the size of a snippet's content, the same limit as
+// pastePost's. Larger snippets are still shown, but not highlighted; see
+// highlight.MaxBytes.
+const maxContentBytes = maxPasteBytes
+
+// snippetCreateForm holds the fields of the create and edit snippet forms and
+// their API equivalents. Passphrase sets a new passphrase; leaving it empty
+// keeps the current one, unless RemovePassphrase is set. BurnAfterReading
+// deletes the snippet once someone other than its author has read it.
+// Encrypted says that Content was encrypted by the client, which keeps the
+// key; see ui/static/js/encrypted.js. editing is set for the edit form and
+// API update, where an Expires of 0 keeps the snippet's current expiry.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title               string   `form:"title" json:"title"`
+	Content             string   `form:"content" json:"content"`
+	Language            string   `form:"language" json:"language"`
+	Visibility          string   `form:"visibility" json:"visibility"`
+	Expires             int      `form:"expires" json:"expires"`
+	Tags                []string `form:"tags" json:"tags"`
+	Passphrase          string   `form:"passphrase" json:"passphrase"`
+	RemovePassphrase    bool     `form:"remove_passphrase" json:"remove_passphrase"`
+	BurnAfterReading    bool     `form:"burn_after_reading" json:"burn_after_reading"`
+	Encrypted           bool     `form:"encrypted" json:"encrypted"`
+	editing             bool
+	validator.Validator `form:"-" json:"-"`
+}
+
+// TagList returns the tags as the comma-separated list shown in the form.
+func (f snippetCreateForm) TagList() string {
+	return strings.Join(f.Tags, ", ")
+}
+
+// input returns the snippet fields held by the form. If no language was
+// chosen, it is detected from the title and content, except for encrypted
+// snippets, whose content can't be read.
+func (f snippetCreateForm) input() models.SnippetInput {
+	in := models.SnippetInput{
+		Title:      f.Title,
+		Content:    f.Content,
+		Language:   f.Language,
+		Visibility: f.Visibility,
+		Expires:    f.Expires,
+		Passphrase: f.Passphrase,
+		Tags:       f.Tags,
+
+		BurnAfterReading: f.BurnAfterReading,
+		Encrypted:        f.Encrypted,
+	}
+
+	if in.Language == "" && !in.Encrypted {
+		in.Language, in.LanguageConfidence = highlight.Detect(f.Title, f.Content)
+	}
+
+	return in
+}
+
+// preview returns an unsaved snippet holding the form's content, for showing
+// the author how it will look.
+func (f snippetCreateForm) preview() models.Snippet {
+	in := f.input()
+
+	return models.Snippet{
+		Title:              in.Title,
+		Content:            in.Content,
+		Language:           in.Language,
+		LanguageConfidence: in.LanguageConfidence,
+		Visibility:         in.Visibility,
+		BurnAfterReading:   in.BurnAfterReading,
+	}
+}
+
+// checkPreview refuses to preview an encrypted snippet, as the server can't
+// read it to render it.
+func (f *snippetCreateForm) checkPreview(r *http.Request) {
+	if r.PostForm.Get("action") == "preview" {
+		f.CheckField(!f.Encrypted, "content", "Encrypted snippets can't be previewed")
+	}
+}
+
+// validate runs the checks shared by the create and edit snippet forms. Tags
+// may be given as separate values or as comma- or space-separated lists; they
+// are normalized to a lowercase, de-duplicated list before being checked. A
+// missing visibility means public, as it did before snippets had one, except
+// for burn-after-reading snippets, which can't be public: anyone browsing the
+// listings could read them before the intended reader did.
+func (f *snippetCreateForm) validate() {
+	f.Tags = normalizeTags(f.Tags)
+	if f.Visibility == "" {
+		f.Visibility = models.VisibilityPublic
+		if f.BurnAfterReading {
+			f.Visibility = models.VisibilityUnlisted
+		}
+	}
+
+	f.CheckField(validator.NotBlank(f.Title), "title", "This field cannot be blank")
+	f.CheckField(validator.MaxChars(f.Title, 100), "title", "This field cannot be more than 100 characters long")
+	f.CheckField(validator.NotBlank(f.Content), "content", "This field cannot be blank")
+	f.CheckField(len(f.Content) <= maxContentBytes, "content", "This field cannot be more than 1 MB long")
+	if f.Encrypted && validator.NotBlank(f.Content) {
+		f.CheckField(validator.Matches(f.Content, validator.CiphertextRX), "content", "This field must be encrypted content")
+	}
+	f.CheckField(f.Language == "" || highlight.IsLanguage(f.Language), "language", "This field must be one of the listed languages")
+	f.CheckField(validator.PermittedValue(f.Visibility, models.Visibilities...), "visibility", "This field must be public, unlisted or private")
+	f.CheckField(!f.BurnAfterReading || f.Visibility != models.VisibilityPublic, "visibility", "Burn after reading snippets cannot be public")
+	if f.editing {
+		f.CheckField(validator.PermittedValue(f.Expires, 0, 1, 7, 365), "expires", "This field must equal 0, 1, 7 or 365")
+	} else {
+		f.CheckField(validator.PermittedValue(f.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	}
+	if f.Passphrase != "" {
+		f.CheckField(validator.MinChars(f.Passphrase, models.MinPassphraseLength), "passphrase", "This field must be at least 8 characters long")
+		f.CheckField(len(f.Passphrase) <= models.MaxPassphraseBytes, "passphrase", "This field cannot be more than 72 bytes long")
+		f.CheckField(!f.RemovePassphrase, "passphrase", "Either set a new passphrase or remove it, not both")
+	}
+	f.CheckField(validator.MaxItems(f.Tags, 10), "tags", "This field cannot have more than 10 tags")
+	for _, tag := range f.Tags {
+		f.CheckField(validator.MaxChars(tag, 30), "tags", "Tags cannot be more than 30 characters long")
+		f.CheckField(validator.Matches(tag, validator.TagRX), "tags", "Tags can only contain letters, digits and the characters + # . -")
+	}
+}
+
+// snippetListForm holds the query string of the snippet browse page. Dates
+// use the YYYY-MM-DD layout of an HTML date input; To is inclusive.
+type snippetListForm struct {
+	Page                int    `form:"page"`
+	Sort                string `form:"sort"`
+	Author              string `form:"author"`
+	Tag                 string `form:"tag"`
+	From                string `form:"from"`
+	To                  string `form:"to"`
+	validator.Validator `form:"-"`
+}
+
+// listOptions validates the form and converts it into models.ListOptions.
+func (f *snippetListForm) listOptions(pageSize int) models.ListOptions {
+	if f.Page == 0 {
+		f.Page = 1
+	}
+	if f.Sort == "" {
+		f.Sort = models.SortNewest
+	}
+
+	f.CheckField(f.Page >= 1 && f.Page <= 10_000_000, "page", "This field must be a positive integer")
+	f.CheckField(validator.PermittedValue(f.Sort, models.SortOrders...), "sort", "This field must equal newest, oldest, expiring or title")
+	f.CheckField(f.From == "" || validator.ValidDate(f.From), "from", "This field must be a date")
+	f.CheckField(f.To == "" || validator.ValidDate(f.To), "to", "This field must be a date")
+
+	opts := models.ListOptions{
+		Page:     f.Page,
+		PageSize: pageSize,
+		Sort:     f.Sort,
+		Author:   strings.TrimSpace(f.Author),
+		Tag:      strings.ToLower(strings.TrimSpace(f.Tag)),
+	}
+
+	if from, err := time.Parse(validator.DateLayout, f.From); err == nil {
+		opts.CreatedFrom = from
+	}
+	if to, err := time.Parse(validator.DateLayout, f.To); err == nil {
+		opts.CreatedTo = to.AddDate(0, 0, 1)
+	}
+
+	return opts
+}
+
+// searchForm holds the query string of the search page.
+type searchForm struct {
+	Q                   string `form:"q"`
+	Page                int    `form:"page"`
+	validator.Validator `form:"-"`
+}
+
+// validate checks the form, defaulting Page to the first page.
+func (f *searchForm) validate() {
+	if f.Page == 0 {
+		f.Page = 1
+	}
+
+	f.CheckField(validator.NotBlank(f.Q), "q", "This field cannot be blank")
+	f.CheckField(validator.MaxChars(f.Q, 200), "q", "This field cannot be more than 200 characters long")
+	f.CheckField(f.Page >= 1 && f.Page <= 10_000_000, "page", "This field must be a positive integer")
+}
+
+type themeForm struct {
+	Theme               string `form:"theme"`
+	Redirect            string `form:"redirect"`
+	validator.Validator `form:"-"`
+}
+
+type tokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
 	validator.Validator `form:"-"`
 }
 
@@ -43,37 +236,254 @@ func (a *Application) home(w http.ResponseWriter, r *http.Request) {
 		a.serverError(w, r, err)
 		return
 	}
+
+	w.Header().Add("Vary", "Accept")
+
+	switch responseFormat(r) {
+	case formatJSON:
+		resp := make([]snippetResponse, 0, len(snippets))
+		for _, s := range snippets {
+			resp = append(resp, newSnippetResponse(s))
+		}
+
+		err = a.writeJSON(w, http.StatusOK, map[string]any{"snippets": resp}, nil)
+		if err != nil {
+			a.serverError(w, r, err)
+		}
+	case formatText:
+		// One line per snippet, URL then title, so the list can be fed to
+		// cut or a while read loop.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, s := range snippets {
+			fmt.Fprintf(w, "%s\t%s\n", absoluteURL(r, "/snippet/view/"+s.Key()), s.Title)
+		}
+	default:
+		data := a.newTemplateData(r)
+		data.Snippets = snippets
+		a.render(w, r, http.StatusOK, "home.gohtml", data)
+	}
+}
+
+func (a *Application) snippetList(w http.ResponseWriter, r *http.Request) {
+	var form snippetListForm
+	err := a.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	opts := form.listOptions(20)
+
 	data := a.newTemplateData(r)
+
+	if !form.Valid() {
+		data.Form = form
+		a.render(w, r, http.StatusUnprocessableEntity, "snippets.gohtml", data)
+		return
+	}
+
+	snippets, total, err := a.snippets.List(opts)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
 	data.Snippets = snippets
-	a.render(w, r, http.StatusOK, "home.gohtml", data)
+	data.Pagination = newPagination(r, opts.Page, opts.PageSize, total)
+	a.render(w, r, http.StatusOK, "snippets.gohtml", data)
 }
 
-func (a *Application) snippetView(w http.ResponseWriter, r *http.Request) {
+func (a *Application) tagView(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.Atoi(params.ByName("id"))
-	log.Print("Id", id)
-	if err != nil || id < 1 {
+
+	tag := params.ByName("name")
+	if !validator.Matches(tag, validator.TagRX) {
 		a.notFound(w)
 		return
 	}
 
-	snippet, err := a.snippets.Get(id)
+	var form snippetListForm
+	err := a.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.Tag = tag
+	opts := form.listOptions(20)
+
+	if !form.Valid() {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
 
+	snippets, total, err := a.snippets.List(opts)
 	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			a.notFound(w)
-		} else {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.Form = form
+	data.Snippets = snippets
+	data.Pagination = newPagination(r, opts.Page, opts.PageSize, total)
+	a.render(w, r, http.StatusOK, "tag.gohtml", data)
+}
+
+func (a *Application) tagCloud(w http.ResponseWriter, r *http.Request) {
+	counts, err := a.tags.Counts()
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.TagCloud = newTagCloud(counts)
+	a.render(w, r, http.StatusOK, "tags.gohtml", data)
+}
+
+func (a *Application) highlightCSS(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	theme, ok := strings.CutSuffix(params.ByName("file"), ".css")
+	if !ok {
+		a.notFound(w)
+		return
+	}
+
+	var buf bytes.Buffer
+
+	found, err := highlight.CSS(&buf, theme)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+	if !found {
+		a.notFound(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	buf.WriteTo(w)
+}
+
+func (a *Application) themePost(w http.ResponseWriter, r *http.Request) {
+	var form themeForm
+	err := a.decodePostForm(r, &form)
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !highlight.IsTheme(form.Theme) {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	a.sessionManager.Put(r.Context(), "theme", form.Theme)
+
+	http.Redirect(w, r, localRedirect(form.Redirect, "/"), http.StatusSeeOther)
+}
+
+func (a *Application) snippetSearch(w http.ResponseWriter, r *http.Request) {
+	var form searchForm
+	err := a.formDecoder.Decode(&form, r.URL.Query())
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data := a.newTemplateData(r)
+
+	// An empty query just shows the search box.
+	if strings.TrimSpace(form.Q) == "" {
+		data.Form = form
+		a.render(w, r, http.StatusOK, "search.gohtml", data)
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		data.Form = form
+		a.render(w, r, http.StatusUnprocessableEntity, "search.gohtml", data)
+		return
+	}
+
+	const pageSize = 20
+
+	results, total, err := a.search.Search(form.Q, form.Page, pageSize)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data.Form = form
+	data.SearchResults = newSearchResults(results, form.Q)
+	data.Pagination = newPagination(r, form.Page, pageSize, total)
+	a.render(w, r, http.StatusOK, "search.gohtml", data)
+}
+
+func (a *Application) snippetView(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) || !a.requireBurnConfirmed(w, r, snippet) {
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	switch responseFormat(r) {
+	case formatJSON:
+		err := a.writeJSON(w, http.StatusOK, map[string]any{"snippet": unlockedSnippetResponse(snippet)}, nil)
+		if err != nil {
 			a.serverError(w, r, err)
 		}
 		return
+	case formatText:
+		a.serveSnippetContent(w, r, snippet)
+		return
+	}
+
+	canModify, err := a.canModify(r, snippet)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
 	}
 
 	data := a.newTemplateData(r)
 	data.Snippet = snippet
+	data.CanModify = canModify
+	data.ShowSource = r.URL.Query().Get("source") == "1"
 
 	a.render(w, r, http.StatusOK, "view.gohtml", data)
 }
 
+// snippetRaw serves a snippet's content as plain text, for piping into a
+// shell with curl and the like.
+func (a *Application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) || !a.requireBurnConfirmed(w, r, snippet) {
+		return
+	}
+
+	a.serveSnippetContent(w, r, snippet)
+}
+
+// snippetDownload serves a snippet's content as an attachment, named after
+// its title with the extension of its language.
+func (a *Application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) || !a.requireBurnConfirmed(w, r, snippet) {
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": snippetFileName(snippet)})
+	w.Header().Set("Content-Disposition", disposition)
+
+	a.serveSnippetContent(w, r, snippet)
+}
+
 func (a *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 	var form snippetCreateForm
 	err := a.decodePostForm(r, &form)
@@ -82,10 +492,8 @@ func (a *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.validate()
+	form.checkPreview(r)
 
 	if !form.Valid() {
 		data := a.newTemplateData(r)
@@ -94,8 +502,25 @@ func (a *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	id, err := a.snippets.Insert(form.Title, form.Content, form.Expires)
+	if r.PostForm.Get("action") == "preview" {
+		data := a.newTemplateData(r)
+		data.Form = form
+		data.Snippet = form.preview()
+		data.Preview = true
+		a.render(w, r, http.StatusOK, "create.gohtml", data)
+		return
+	}
+
+	id, err := a.snippets.Insert(a.authenticatedUserID(r), form.input())
+
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
 
+	// Load the snippet back for its key: unlisted snippets must be linked to
+	// by slug.
+	snippet, err := a.snippets.Get(id, a.authenticatedUserID(r))
 	if err != nil {
 		a.serverError(w, r, err)
 		return
@@ -103,17 +528,351 @@ func (a *Application) snippetCreatePost(w http.ResponseWriter, r *http.Request)
 
 	a.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	http.Redirect(w, r, "/snippet/view/"+snippet.Key(), http.StatusSeeOther)
 }
 
 func (a *Application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := a.newTemplateData(r)
 	data.Form = snippetCreateForm{
-		Expires: 7,
+		Visibility: models.VisibilityPublic,
+		Expires:    7,
 	}
 	a.render(w, r, http.StatusOK, "create.gohtml", data)
 }
 
+func (a *Application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.Snippet = snippet
+	form := snippetCreateForm{
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Visibility: snippet.Visibility,
+		Tags:       snippet.Tags,
+
+		BurnAfterReading: snippet.BurnAfterReading,
+		Encrypted:        snippet.Encrypted,
+	}
+
+	// Leave a detected language on automatic so that it is detected again
+	// from the edited content, unless the author picks one.
+	if snippet.LanguageConfidence > 0 {
+		form.Language = ""
+	}
+
+	data.Form = form
+	a.render(w, r, http.StatusOK, "edit.gohtml", data)
+}
+
+func (a *Application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetCreateForm
+	err := a.decodePostForm(r, &form)
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Visibility == "" {
+		form.Visibility = snippet.Visibility
+	}
+
+	// A snippet stays encrypted, or not, for life.
+	form.Encrypted = snippet.Encrypted
+	form.editing = true
+
+	form.validate()
+	form.checkPreview(r)
+
+	if !form.Valid() {
+		data := a.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		a.render(w, r, http.StatusUnprocessableEntity, "edit.gohtml", data)
+		return
+	}
+
+	if r.PostForm.Get("action") == "preview" {
+		data := a.newTemplateData(r)
+		data.Snippet = form.preview()
+		data.Snippet.ID = snippet.ID
+		data.Snippet.Slug = snippet.Slug
+		data.Snippet.HashedPassphrase = snippet.HashedPassphrase
+		data.Snippet.Expires = snippet.Expires
+		data.Form = form
+		data.Preview = true
+		a.render(w, r, http.StatusOK, "edit.gohtml", data)
+		return
+	}
+
+	err = a.snippets.Update(snippet.ID, a.authenticatedUserID(r), form.input())
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	if form.RemovePassphrase {
+		err = a.snippets.SetPassphrase(snippet.ID, "")
+		if err != nil {
+			a.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Unlisting a snippet can give it a new slug, so load it back as its
+	// author for the link.
+	snippet, err = a.snippets.Get(snippet.ID, snippet.UserID)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	a.sessionManager.Put(r.Context(), "flash", "Snippet successfully updated!")
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Key(), http.StatusSeeOther)
+}
+
+func (a *Application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w)
+		} else {
+			a.serverError(w, r, err)
+		}
+		return
+	}
+
+	a.sessionManager.Put(r.Context(), "flash", "Snippet successfully deleted!")
+
+	http.Redirect(w, r, "/user/snippets", http.StatusSeeOther)
+}
+
+func (a *Application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) || !a.requireBurnConfirmed(w, r, snippet) {
+		return
+	}
+
+	revisions, err := a.revisions.All(snippet.ID)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	canModify, err := a.canModify(r, snippet)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.CanModify = canModify
+	a.render(w, r, http.StatusOK, "history.gohtml", data)
+}
+
+func (a *Application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok || !a.requireUnlocked(w, r, snippet) || !a.requireBurnConfirmed(w, r, snippet) {
+		return
+	}
+
+	revisions, err := a.revisions.All(snippet.ID)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	if len(revisions) == 0 {
+		a.notFound(w)
+		return
+	}
+
+	// Without explicit revisions, show the most recent change.
+	to := revisions[0].Number
+	from := to - 1
+
+	query := r.URL.Query()
+	if v := query.Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			a.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("from"); v != "" {
+		from, err = strconv.Atoi(v)
+		if err != nil {
+			a.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var d diffData
+	for _, rev := range revisions {
+		switch rev.Number {
+		case from:
+			d.From = rev
+		case to:
+			d.To = rev
+		}
+	}
+
+	// Revision 0 stands for the empty snippet, so the first revision can be
+	// compared against nothing.
+	if (d.From.Number == 0 && from != 0) || d.To.Number == 0 {
+		a.notFound(w)
+		return
+	}
+
+	d.Hunks = diff.Unified(d.From.Content, d.To.Content, 3)
+
+	data := a.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.Diff = d
+	a.render(w, r, http.StatusOK, "diff.gohtml", data)
+}
+
+func (a *Application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetForModification(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	revision, err := strconv.Atoi(r.PostForm.Get("revision"))
+	if err != nil || revision < 1 {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = a.snippets.Restore(snippet.ID, a.authenticatedUserID(r), revision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w)
+		} else {
+			a.serverError(w, r, err)
+		}
+		return
+	}
+
+	a.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet restored to revision %d!", revision))
+
+	http.Redirect(w, r, "/snippet/view/"+snippet.Key(), http.StatusSeeOther)
+}
+
+func (a *Application) userSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := a.snippets.ByUser(a.authenticatedUserID(r))
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.Snippets = snippets
+	a.render(w, r, http.StatusOK, "mine.gohtml", data)
+}
+
+func (a *Application) userTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := a.tokens.ForUser(a.authenticatedUserID(r))
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	data := a.newTemplateData(r)
+	data.Tokens = tokens
+	data.Form = tokenCreateForm{
+		Scope: models.ScopeRead,
+	}
+	a.render(w, r, http.StatusOK, "tokens.gohtml", data)
+}
+
+func (a *Application) userTokensPost(w http.ResponseWriter, r *http.Request) {
+	userID := a.authenticatedUserID(r)
+
+	var form tokenCreateForm
+	err := a.decodePostForm(r, &form)
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValue(form.Scope, models.ScopeRead, models.ScopeWrite), "scope", "This field must equal read or write")
+
+	status := http.StatusOK
+	data := a.newTemplateData(r)
+
+	if form.Valid() {
+		data.NewToken, err = a.tokens.Insert(userID, form.Name, form.Scope)
+		if err != nil {
+			a.serverError(w, r, err)
+			return
+		}
+		form = tokenCreateForm{Scope: models.ScopeRead}
+	} else {
+		status = http.StatusUnprocessableEntity
+	}
+
+	data.Tokens, err = a.tokens.ForUser(userID)
+	if err != nil {
+		a.serverError(w, r, err)
+		return
+	}
+
+	// The plaintext token is rendered straight into this response rather than
+	// flashed through the session, so it is never stored anywhere.
+	w.Header().Set("Cache-Control", "no-store")
+	data.Form = form
+	a.render(w, r, status, "tokens.gohtml", data)
+}
+
+func (a *Application) userTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		a.notFound(w)
+		return
+	}
+
+	err = a.tokens.Revoke(id, a.authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			a.notFound(w)
+		} else {
+			a.serverError(w, r, err)
+		}
+		return
+	}
+
+	a.sessionManager.Put(r.Context(), "flash", "API token revoked.")
+	http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+}
+
 func (a *Application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := a.newTemplateData(r)
 	data.Form = userSignupForm{}
@@ -132,6 +891,7 @@ func (a *Application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
 	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
 	form.CheckField(!validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(!strings.EqualFold(form.Email, models.AnonymousEmail), "email", "Email address is already in use")
 	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
 
@@ -206,6 +966,14 @@ func (a *Application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	a.sessionManager.Put(r.Context(), "authenticatedUserID", id)
 
+	// Send the user back to the page requireAuthentication turned them away
+	// from, if there was one.
+	path := a.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	if path != "" {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+
 	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
 }
 func (a *Application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
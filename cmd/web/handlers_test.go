@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+func TestSnippetCreatePostEscaping(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	userID := ts.login(t, app, "alice@example.com")
+
+	// Markup that would run script if any page wrote it out unescaped.
+	forbidden := []string{
+		"<script>alert",
+		"<img src=x onerror",
+		"<svg onload",
+		`href="javascript:`,
+	}
+
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		language string
+	}{
+		{
+			name:    "Script tag",
+			title:   "<script>alert(1)</script>",
+			content: "<script>alert(1)</script>",
+		},
+		{
+			name:    "Event handler",
+			title:   `<img src=x onerror=alert(1)>`,
+			content: `<img src=x onerror=alert(1)>`,
+		},
+		{
+			name:    "Attribute breakout",
+			title:   `"><svg onload=alert(1)>`,
+			content: `'"><svg onload=alert(1)>`,
+		},
+		{
+			name:    "Textarea breakout",
+			title:   `</title><script>alert(1)</script>`,
+			content: `</textarea><script>alert(1)</script>`,
+		},
+		{
+			name:     "Highlighted code",
+			title:    "<script>alert(1)</script>",
+			content:  "// </span><script>alert(1)</script>\nfunc main() {}",
+			language: "go",
+		},
+		{
+			name:     "Markdown",
+			title:    "<script>alert(1)</script>",
+			content:  "# Hi\n\n<script>alert(1)</script>\n\n[click](javascript:alert(1))\n\n<img src=x onerror=alert(1)>",
+			language: "markdown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", tt.title)
+			form.Add("content", tt.content)
+			form.Add("language", tt.language)
+			form.Add("expires", "7")
+			form.Add("csrf_token", ts.csrfToken(t, "/snippet/create"))
+
+			code, header, _ := ts.postForm(t, "/snippet/create", form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+			}
+
+			location := header.Get("Location")
+			key := strings.TrimPrefix(location, "/snippet/view/")
+
+			// Snippets are stored as written; escaping is left to whatever
+			// displays them, so raw and download responses are unchanged.
+			snippet, err := app.snippets.GetBySlug(key, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippet.Title != tt.title || snippet.Content != tt.content {
+				t.Errorf("got stored title %q and content %q; want them as posted", snippet.Title, snippet.Content)
+			}
+
+			pages := []string{location, "/", "/snippets", "/user/snippets", "/snippet/edit/" + key}
+
+			for _, page := range pages {
+				code, _, body := ts.get(t, page)
+				if code != http.StatusOK {
+					t.Fatalf("%s: got status %d; want %d", page, code, http.StatusOK)
+				}
+
+				for _, s := range forbidden {
+					if strings.Contains(body, s) {
+						t.Errorf("%s: found %q in the page", page, s)
+					}
+				}
+
+				if !strings.Contains(body, template.HTMLEscapeString(tt.title)) {
+					t.Errorf("%s: escaped title not found in the page", page)
+				}
+			}
+
+			code, header, body := ts.get(t, "/snippet/raw/"+key)
+			if code != http.StatusOK || body != strings.TrimSpace(tt.content) {
+				t.Errorf("raw: got status %d and body %q; want %d and the content as posted", code, body, http.StatusOK)
+			}
+			if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+				t.Errorf("raw: got Content-Type %q; want text/plain", ct)
+			}
+		})
+	}
+}
+
+func TestLegacyIDs(t *testing.T) {
+	tests := []struct {
+		name         string
+		legacyIDs    bool
+		visibility   string
+		wantCode     int
+		wantLocation bool
+	}{
+		{"Off", false, models.VisibilityPublic, http.StatusNotFound, false},
+		{"On", true, models.VisibilityPublic, http.StatusMovedPermanently, true},
+		{"On for an unlisted snippet", true, models.VisibilityUnlisted, http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.legacyIDs = tt.legacyIDs
+			ts := newTestServer(t, app.routes())
+
+			userID := newTestUser(t, app, "alice@example.com")
+
+			id, err := app.snippets.Insert(userID, models.SnippetInput{Title: "Old", Content: "Old", Visibility: tt.visibility, Expires: 7})
+			if err != nil {
+				t.Fatal(err)
+			}
+			snippet, err := app.snippets.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, header, _ := ts.get(t, fmt.Sprintf("/snippet/view/%d", id))
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+
+			wantLocation := ""
+			if tt.wantLocation {
+				wantLocation = "/snippet/view/" + snippet.Slug
+			}
+			if got := header.Get("Location"); got != wantLocation {
+				t.Errorf("got Location %q; want %q", got, wantLocation)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostEncrypted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	userID := ts.login(t, app, "alice@example.com")
+
+	const ciphertext = "v1:AAECAwQFBgcICQoL:3q2-7w_mYWJjZGVmZ2hpams"
+
+	tests := []struct {
+		name      string
+		content   string
+		action    string
+		wantCode  int
+		wantError string
+	}{
+		{"Ciphertext", ciphertext, "", http.StatusSeeOther, ""},
+		{"Plain text", "echo hello", "", http.StatusUnprocessableEntity, "This field must be encrypted content"},
+		{"Standard base64", "v1:AAECAwQFBgcICQoL:3q2+7w/mYWJjZGVmZ2hpams", "", http.StatusUnprocessableEntity, "This field must be encrypted content"},
+		{"Preview", ciphertext, "preview", http.StatusUnprocessableEntity, "Encrypted snippets can&#39;t be previewed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := app.snippets.ByUser(userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			form := url.Values{}
+			form.Add("title", "Encrypted")
+			form.Add("content", tt.content)
+			form.Add("encrypted", "true")
+			form.Add("expires", "7")
+			form.Add("csrf_token", ts.csrfToken(t, "/snippet/create"))
+			if tt.action != "" {
+				form.Add("action", tt.action)
+			}
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantError != "" && !strings.Contains(body, tt.wantError) {
+				t.Errorf("got no error %q in the page", tt.wantError)
+			}
+
+			after, err := app.snippets.ByUser(userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved := len(after) > len(before); saved != (tt.wantCode == http.StatusSeeOther) {
+				t.Fatalf("got snippet saved %t; want %t", saved, !saved)
+			}
+			if tt.wantCode == http.StatusSeeOther && (after[0].Content != tt.content || !after[0].Encrypted) {
+				t.Errorf("got content %q, encrypted %t; want the ciphertext stored as given", after[0].Content, after[0].Encrypted)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePostTooLarge(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, app, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		size     int
+		wantCode int
+	}{
+		{"At the limit", maxContentBytes, http.StatusSeeOther},
+		{"Too large", maxContentBytes + 1, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Large")
+			form.Add("content", strings.Repeat("a", tt.size))
+			form.Add("language", "plaintext")
+			form.Add("expires", "7")
+			form.Add("csrf_token", ts.csrfToken(t, "/snippet/create"))
+
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if code == http.StatusUnprocessableEntity && !strings.Contains(body, "This field cannot be more than 1 MB long") {
+				t.Error("got no error about the size")
+			}
+		})
+	}
+}
+
+func TestSnippetEditPostExpires(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	userID := ts.login(t, app, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		expires  string
+		wantDays int
+	}{
+		{"Form default", "", 365},
+		{"Keep current", "0", 365},
+		{"One week", "7", 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := app.snippets.Insert(userID, models.SnippetInput{
+				Title:      "Hello",
+				Content:    "Hello",
+				Visibility: models.VisibilityPublic,
+				Expires:    365,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			snippet, err := app.snippets.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			editPath := "/snippet/edit/" + snippet.Key()
+
+			// The edit form keeps the current expiry unless another is picked.
+			_, _, body := ts.get(t, editPath)
+			if !strings.Contains(body, `value="0" checked`) {
+				t.Fatal("got keeping the current expiry not picked in the form")
+			}
+
+			form := url.Values{}
+			form.Add("title", "Hello")
+			form.Add("content", "Hello, world")
+			form.Add("language", "plaintext")
+			form.Add("csrf_token", ts.csrfToken(t, editPath))
+			if tt.expires != "" {
+				form.Add("expires", tt.expires)
+			}
+
+			if code, _, _ := ts.postForm(t, editPath, form); code != http.StatusSeeOther {
+				t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+			}
+
+			edited, err := app.snippets.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := snippet.Created.AddDate(0, 0, tt.wantDays)
+			if d := edited.Expires.Sub(want); d < -time.Minute || d > time.Minute {
+				t.Errorf("got expiry %v; want %v", edited.Expires, want)
+			}
+		})
+	}
+}
@@ -2,12 +2,25 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/fayazp088/snippet-box/internal/highlight"
+	"github.com/fayazp088/snippet-box/internal/models"
 	"github.com/go-playground/form"
+	"github.com/julienschmidt/httprouter"
 )
 
 // The serverError helper writes a log entry at Error level (including the request
@@ -61,11 +74,276 @@ func (app *Application) render(w http.ResponseWriter, r *http.Request, status in
 
 func (app *Application) newTemplateData(r *http.Request) templateData {
 	return templateData{
-		CurrentYear: time.Now().Year(),
-		Flash:       app.sessionManager.PopString(r.Context(), "flash"),
+		CurrentYear:     time.Now().Year(),
+		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated: app.isAuthenticated(r),
+		CSRFToken:       app.csrfToken(r),
+		Languages:       highlight.Languages,
+		Theme:           app.theme(r),
+		Themes:          highlight.Themes,
 	}
 }
 
+// theme returns the highlighting theme chosen by the user, or the default
+// theme if they have not chosen one.
+func (app *Application) theme(r *http.Request) string {
+	theme := app.sessionManager.GetString(r.Context(), "theme")
+	if !highlight.IsTheme(theme) {
+		return highlight.DefaultTheme
+	}
+	return theme
+}
+
+// authenticatedUserID returns the ID of the user that the authenticate or
+// authenticateToken middleware found for the request, or 0 if there is none.
+func (app *Application) authenticatedUserID(r *http.Request) int {
+	id, _ := r.Context().Value(authenticatedUserIDContextKey).(int)
+	return id
+}
+
+// isAuthenticated reports whether the authenticate middleware found a valid
+// user for the request.
+func (app *Application) isAuthenticated(r *http.Request) bool {
+	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	if !ok {
+		return false
+	}
+	return isAuthenticated
+}
+
+// lookupSnippet loads the snippet identified by key, which is its slug or,
+// while legacy IDs are allowed, its numeric ID, if the current user may see
+// it. Snippets the user may not see are reported as models.ErrNoRecord, so
+// their existence is not revealed.
+func (app *Application) lookupSnippet(r *http.Request, key string) (models.Snippet, error) {
+	viewerID := app.authenticatedUserID(r)
+
+	if models.IsNumericKey(key) {
+		id, err := strconv.Atoi(key)
+		if err != nil || id < 1 || !app.legacyIDs {
+			return models.Snippet{}, models.ErrNoRecord
+		}
+		return app.snippets.Get(id, viewerID)
+	}
+
+	return app.snippets.GetBySlug(key, viewerID)
+}
+
+// snippetFromParams loads the snippet named by the :id route parameter. If it
+// cannot be found or the current user may not see it, a 404 response has
+// already been sent and ok is false. Pages asked for by numeric ID are
+// redirected to the same page under the snippet's slug, and snippets that
+// have been burned after reading answered with 410 Gone; ok is false for
+// both.
+func (app *Application) snippetFromParams(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	key := params.ByName("id")
+
+	snippet, err := app.lookupSnippet(r, key)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	if models.IsNumericKey(key) && snippet.Slug != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		http.Redirect(w, r, replacePathSegment(r.URL, key, snippet.Slug), http.StatusMovedPermanently)
+		return models.Snippet{}, false
+	}
+
+	if !snippet.Burned.IsZero() {
+		app.snippetBurned(w, r, snippet)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// replacePathSegment returns the request URI of u with the first path
+// segment equal to old replaced by new.
+func replacePathSegment(u *url.URL, old, new string) string {
+	segments := strings.Split(u.Path, "/")
+
+	for i, segment := range segments {
+		if segment == old {
+			segments[i] = new
+			break
+		}
+	}
+
+	v := *u
+	v.Path = strings.Join(segments, "/")
+	v.RawPath = ""
+
+	return v.RequestURI()
+}
+
+// localRedirect returns target if it is a path on this site and fallback
+// otherwise, so that forms naming a page to return to can't be used to send
+// people elsewhere.
+func localRedirect(target, fallback string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return fallback
+	}
+	return target
+}
+
+// serveSnippetContent writes a snippet's content as plain text. The ETag is
+// a hash of the content and Last-Modified the time of the last edit, so
+// http.ServeContent can answer conditional and range requests for us.
+func (app *Application) serveSnippetContent(w http.ResponseWriter, r *http.Request, snippet models.Snippet) {
+	sum := sha256.Sum256([]byte(snippet.Content))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", snippet.Updated, strings.NewReader(snippet.Content))
+}
+
+// absoluteURL turns a path on this site into a full URL, for responses read
+// by tools rather than browsers. The server only speaks HTTPS.
+func absoluteURL(r *http.Request, path string) string {
+	return "https://" + r.Host + path
+}
+
+// Response formats chosen by responseFormat.
+const (
+	formatHTML = "html"
+	formatJSON = "json"
+	formatText = "text"
+)
+
+// mediaFormats maps the media types we can produce onto response formats.
+var mediaFormats = map[string]string{
+	"text/html":             formatHTML,
+	"application/xhtml+xml": formatHTML,
+	"application/json":      formatJSON,
+	"text/plain":            formatText,
+}
+
+// responseFormat decides whether a page should be sent as HTML, JSON or plain
+// text. A ?format= of html, json or text wins; otherwise the media type the
+// Accept header prefers most is used. Wildcards and anything we don't produce
+// are ignored, so browsers and bare curl requests get HTML.
+func responseFormat(r *http.Request) string {
+	switch format := r.URL.Query().Get("format"); format {
+	case formatHTML, formatJSON, formatText:
+		return format
+	case "txt":
+		return formatText
+	}
+
+	best, bestQ := formatHTML, 0.0
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+
+		format, ok := mediaFormats[mediaType]
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+
+	return best
+}
+
+// snippetFileName makes a file name for downloading a snippet from its title,
+// replacing runs of anything but letters, digits, dots, dashes and
+// underscores with a dash. The extension of the snippet's language is added
+// unless the title already ends in an extension for that language.
+func snippetFileName(snippet models.Snippet) string {
+	words := strings.FieldsFunc(snippet.Title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".-_", r)
+	})
+
+	name := strings.Trim(strings.Join(words, "-"), ".-")
+	if name == "" {
+		name = fmt.Sprintf("snippet-%d", snippet.ID)
+	}
+
+	language := snippet.Language
+	if language == "" {
+		language = highlight.PlainText
+	}
+
+	ext := path.Ext(name)
+	if ext != "" && (strings.EqualFold(ext, highlight.Extension(language)) || highlight.ExtensionLanguage(ext) == language) {
+		return name
+	}
+
+	return name + highlight.Extension(language)
+}
+
+// canModify reports whether the current user may edit or delete the snippet:
+// only its author or an admin may do so.
+func (app *Application) canModify(r *http.Request, snippet models.Snippet) (bool, error) {
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		return false, nil
+	}
+
+	if snippet.UserID == userID {
+		return true, nil
+	}
+
+	user, err := app.users.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return user.IsAdmin, nil
+}
+
+// snippetForModification loads the snippet named by the :id route parameter
+// and checks that the current user may modify it. If not, an appropriate error
+// response has already been sent and ok is false.
+func (app *Application) snippetForModification(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	snippet, ok = app.snippetFromParams(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	canModify, err := app.canModify(r, snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return models.Snippet{}, false
+	}
+
+	if !canModify {
+		app.clientError(w, http.StatusForbidden)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// csrfToken returns the CSRF token that csrfProtect attached to the request.
+func (app *Application) csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfTokenContextKey).(string)
+	return token
+}
+
 func (app *Application) decodePostForm(r *http.Request, dst any) error {
 	// Call ParseForm() on the request, in the same way that we did in our // createSnippetPost handler.
 	err := r.ParseForm()
@@ -85,3 +363,119 @@ func (app *Application) decodePostForm(r *http.Request, dst any) error {
 	}
 	return nil
 }
+
+// normalizeTags splits raw tag input on commas and whitespace, lowercases
+// each tag and drops duplicates, keeping the order in which tags first appear.
+func normalizeTags(raw []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, value := range raw {
+		fields := strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+
+		for _, tag := range fields {
+			tag = strings.ToLower(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
+
+// newPagination works out the previous and next page links for a paginated
+// list, keeping the rest of the request's query string intact.
+func newPagination(r *http.Request, page, pageSize, total int) pagination {
+	p := pagination{
+		Page:     page,
+		LastPage: max((total+pageSize-1)/pageSize, 1),
+		Total:    total,
+	}
+
+	pageURL := func(n int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(n))
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	if page > 1 {
+		p.PrevURL = pageURL(min(page-1, p.LastPage))
+	}
+	if page < p.LastPage {
+		p.NextURL = pageURL(page + 1)
+	}
+
+	return p
+}
+
+// writeJSON sends data as a JSON response with the given status code.
+func (app *Application) writeJSON(w http.ResponseWriter, status int, data any, headers http.Header) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// readJSON decodes a single JSON object from the request body into dst. The
+// body must be sent as application/json, must not exceed 1MB and must not
+// contain unknown fields.
+func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	mediaType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	if mediaType != "application/json" {
+		return errors.New("body must be sent with Content-Type: application/json")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
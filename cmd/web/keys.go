@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/fayazp088/snippet-box/internal/envelope"
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// masterKeysEnv holds the master keys when no -master-key-file is given.
+const masterKeysEnv = "SNIPPETBOX_MASTER_KEYS"
+
+const keysUsage = `usage: web [flags] keys <command>
+
+Commands:
+  generate <id>  print a new random master key with the given ID
+  rotate         wrap every data key with the primary master key, and encrypt
+                 snippets still stored in clear text
+  status         count snippets by the master key that wraps their data key`
+
+// loadMasterKeys reads the master keys that encrypt snippet content from
+// file, or from the SNIPPETBOX_MASTER_KEYS environment variable if file is
+// empty. It returns nil if neither is set, in which case content is stored in
+// clear text.
+func loadMasterKeys(file string) (*envelope.Keyring, error) {
+	if file == "" {
+		text := os.Getenv(masterKeysEnv)
+		if text == "" {
+			return nil, nil
+		}
+		return envelope.ParseKeys(text)
+	}
+
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope.ParseKeys(string(text))
+}
+
+// reloadMasterKeysOnHangup reads the master key file again whenever the
+// process gets SIGHUP, so that a new primary key can be brought in, or an old
+// one retired, without a restart.
+func (app *Application) reloadMasterKeysOnHangup(keys *envelope.Keyring, file string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		reloaded, err := loadMasterKeys(file)
+		if err != nil {
+			app.logger.Error("reloading master keys", "error", err.Error())
+			continue
+		}
+
+		keys.Replace(reloaded)
+		app.logger.Info("reloaded master keys", "primary", keys.Primary())
+	}
+}
+
+// runKeys implements the "keys" subcommand.
+func (app *Application) runKeys(w io.Writer, driver, dsn string, keys *envelope.Keyring, args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	if args[0] == "generate" {
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		key, err := envelope.GenerateKey(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, key)
+		return nil
+	}
+
+	if args[0] != "rotate" && args[0] != "status" {
+		return errors.New(keysUsage)
+	}
+
+	db, err := openDatabase(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	snippets := &models.SnippetModel{DB: db, Keys: keys}
+
+	switch args[0] {
+	case "rotate":
+		if keys == nil {
+			return fmt.Errorf("no master keys: set -master-key-file or %s", masterKeysEnv)
+		}
+
+		rewrapped, err := snippets.RewrapKeys()
+		fmt.Fprintf(w, "wrapped %d data keys with %s\n", rewrapped, keys.Primary())
+		if err != nil {
+			return err
+		}
+
+		encrypted, err := snippets.EncryptAll()
+		fmt.Fprintf(w, "encrypted %d snippets stored in clear text\n", encrypted)
+		return err
+	default:
+		usage, err := snippets.KeyUsage()
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(usage))
+		for id := range usage {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "MASTER KEY\tSNIPPETS")
+		for _, id := range ids {
+			name := id
+			switch {
+			case id == "":
+				name = "(clear text)"
+			case keys != nil && id == keys.Primary():
+				name += " (primary)"
+			}
+			fmt.Fprintf(tw, "%s\t%d\n", name, usage[id])
+		}
+		return tw.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// attemptLimiter limits how often something, such as guessing a snippet's
+// passphrase, may be tried per key within a window of time. Attempts are
+// counted when they start, so that concurrent guesses can't slip past the
+// limit while the first is still being checked, and a success resets the
+// count. The counts live in process memory.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	attempts map[string]*attemptWindow
+}
+
+// attemptWindow counts the attempts made for a key since start.
+type attemptWindow struct {
+	start time.Time
+	count int
+}
+
+// sweepThreshold is the number of keys above which expired windows are
+// cleared out, so that the map doesn't grow without bound.
+const sweepThreshold = 10_000
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string]*attemptWindow),
+	}
+}
+
+// Attempt records an attempt for key. If the key has already used up its
+// attempts, nothing is recorded, ok is false and retryAfter is how long until
+// it may try again.
+func (l *attemptLimiter) Attempt(key string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if len(l.attempts) > sweepThreshold {
+		for k, w := range l.attempts {
+			if now.Sub(w.start) >= l.window {
+				delete(l.attempts, k)
+			}
+		}
+	}
+
+	w, found := l.attempts[key]
+	if !found || now.Sub(w.start) >= l.window {
+		w = &attemptWindow{start: now}
+		l.attempts[key] = w
+	}
+
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.count++
+
+	return true, 0
+}
+
+// Reset forgets the attempts made for key.
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// clientIP returns the address of the client that sent the request, without
+// the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	type step struct {
+		key       string
+		reset     bool
+		expire    bool // move the key's window into the past first
+		wantOK    bool
+		wantRetry bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "Up to the limit",
+			steps: []step{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: true},
+				{key: "a", wantOK: false, wantRetry: true},
+			},
+		},
+		{
+			name: "Keys counted separately",
+			steps: []step{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "b", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: true},
+			},
+		},
+		{
+			name: "Reset after success",
+			steps: []step{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", reset: true, wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: true},
+			},
+		},
+		{
+			name: "Window expires",
+			steps: []step{
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: true},
+				{key: "a", wantOK: false, wantRetry: true},
+				{key: "a", expire: true, wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAttemptLimiter(3, time.Minute)
+
+			for i, s := range tt.steps {
+				if s.reset {
+					l.Reset(s.key)
+				}
+				if s.expire {
+					l.attempts[s.key].start = time.Now().Add(-time.Minute)
+				}
+
+				ok, retryAfter := l.Attempt(s.key)
+				if ok != s.wantOK {
+					t.Errorf("step %d: got ok %t; want %t", i, ok, s.wantOK)
+				}
+				if (retryAfter > 0) != s.wantRetry || retryAfter > time.Minute {
+					t.Errorf("step %d: got retry after %s; want a wait %t", i, retryAfter, s.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestAttemptLimiterSweep(t *testing.T) {
+	l := newAttemptLimiter(1, time.Minute)
+
+	for i := 0; i <= sweepThreshold; i++ {
+		l.attempts[strconv.Itoa(i)] = &attemptWindow{start: time.Now().Add(-time.Hour), count: 1}
+	}
+	l.attempts["live"] = &attemptWindow{start: time.Now(), count: 1}
+
+	l.Attempt("new")
+
+	if len(l.attempts) != 2 {
+		t.Errorf("got %d keys after sweeping; want 2", len(l.attempts))
+	}
+	if ok, _ := l.Attempt("live"); ok {
+		t.Error("got a live window swept away")
+	}
+}
@@ -2,44 +2,69 @@ package main
 
 import (
 	"crypto/tls"
-	"database/sql"
 	"flag"
+	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
-	"text/template"
 	"time"
 
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/fayazp088/snippet-box/internal/models"
 	"github.com/go-playground/form"
-	_ "github.com/go-sql-driver/mysql"
 )
 
 type Application struct {
 	logger         *slog.Logger
-	snippets       *models.SnippetModel
-	users          *models.UserModel
+	snippets       models.SnippetStore
+	search         models.SnippetSearcher
+	users          models.UserStore
+	revisions      models.RevisionStore
+	tags           models.TagStore
+	tokens         models.TokenStore
 	templteCache   map[string]*template.Template
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+
+	// anonymousUserID owns snippets pasted without an API token. It is 0
+	// unless anonymous pasting is turned on.
+	anonymousUserID int
+
+	// legacyIDs lets snippets still be found by their numeric ID, as in
+	// links made before snippets had slugs. Pages redirect to the slug.
+	legacyIDs bool
+
+	// unlockAttempts limits guesses at the passphrases of protected
+	// snippets.
+	unlockAttempts *attemptLimiter
 }
 
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	addr := flag.String("addr", ":8080", "HTTP network address")
 
-	dsn := flag.String("dsn", "admin:admin@/snippets?parseTime=true", "MYSQL Data Source Name")
-	db, err := OpenDB(*dsn)
+	dbDriver := flag.String("db-driver", "mysql", "Storage backend: mysql, sqlite or memory")
+	dsn := flag.String("dsn", "", "Data Source Name (defaults to a local database for the chosen driver)")
+	autoMigrate := flag.Bool("auto-migrate", false, "Apply pending schema migrations at startup")
+	anonymousPaste := flag.Bool("anonymous-paste", false, "Allow pasting snippets without an API token")
+	slugLength := flag.Int("slug-length", models.DefaultSlugLength, "Length of the random slugs in snippet links")
+	legacyIDs := flag.Bool("legacy-ids", false, "Redirect links that use numeric snippet IDs to the snippet's slug")
+	masterKeyFile := flag.String("master-key-file", "", "File of master keys that encrypt snippet content (default $"+masterKeysEnv+")")
+
+	flag.Parse()
+
+	if *slugLength < models.MinSlugLength || *slugLength > models.MaxSlugLength {
+		logger.Error(fmt.Sprintf("-slug-length must be between %d and %d", models.MinSlugLength, models.MaxSlugLength))
+		os.Exit(1)
+	}
 
+	masterKeys, err := loadMasterKeys(*masterKeyFile)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
-	defer db.Close()
-
 	tmplCache, err := templateCache()
 
 	if err != nil {
@@ -49,19 +74,58 @@ func main() {
 
 	formDecoder := form.NewDecoder()
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
 	sessionManager.Lifetime = 12 * time.Hour
 
 	app := &Application{
 		logger:         logger,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
 		templteCache:   tmplCache,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		legacyIDs:      *legacyIDs,
+		unlockAttempts: newAttemptLimiter(maxUnlockAttempts, unlockAttemptWindow),
 	}
 
-	flag.Parse()
+	if flag.Arg(0) == "migrate" {
+		err = app.runMigrate(os.Stdout, *dbDriver, *dsn, flag.Args()[1:])
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "keys" {
+		err = app.runKeys(os.Stdout, *dbDriver, *dsn, masterKeys, flag.Args()[1:])
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	closeStores, err := app.openStores(*dbDriver, *dsn, *autoMigrate, *slugLength, masterKeys)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	defer closeStores()
+
+	if masterKeys != nil {
+		logger.Info("encrypting snippet content", "primary-key", masterKeys.Primary())
+		if *masterKeyFile != "" {
+			go app.reloadMasterKeysOnHangup(masterKeys, *masterKeyFile)
+		}
+	}
+
+	if *anonymousPaste {
+		app.anonymousUserID, err = app.users.Anonymous()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
 	tlsConfig := &tls.Config{
 		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
@@ -77,7 +141,7 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	logger.Info("starting server on :8080", "addr", *addr)
+	logger.Info("starting server on :8080", "addr", *addr, "db-driver", *dbDriver)
 
 	err = server.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
 
@@ -87,18 +151,3 @@ func main() {
 
 	os.Exit(1)
 }
-
-func OpenDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err = db.Ping(); err != nil {
-		db.Close()
-		return nil, err
-	}
-
-	return db, nil
-}
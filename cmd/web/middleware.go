@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 )
@@ -47,3 +51,92 @@ func (app *Application) recoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *Application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If the user is not authenticated, remember the page they asked for
+		// so userLoginPost can send them back there, then redirect them to
+		// the login page.
+		if !app.isAuthenticated(r) {
+			if r.Method == http.MethodGet {
+				app.sessionManager.Put(r.Context(), "redirectPathAfterLogin", r.URL.RequestURI())
+			}
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Pages that require authentication should not be stored in the
+		// user's browser cache (or other intermediary cache).
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The user may have been deleted since they logged in, so check that
+		// they still exist before trusting the session.
+		exists, err := app.users.Exists(id)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if exists {
+			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfProtect implements the synchronizer token pattern. Each session is given
+// a random token which every form must send back in its csrf_token field (or
+// an X-CSRF-Token header); state-changing requests without a matching token
+// are rejected.
+func (app *Application) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := app.sessionManager.GetString(r.Context(), "csrfToken")
+		if token == "" {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			token = base64.RawURLEncoding.EncodeToString(b)
+			app.sessionManager.Put(r.Context(), "csrfToken", token)
+		}
+
+		ctx := context.WithValue(r.Context(), csrfTokenContextKey, token)
+		r = r.WithContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		submitted := r.Header.Get("X-CSRF-Token")
+		if submitted == "" {
+			submitted = r.PostFormValue("csrf_token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			app.logger.Warn("csrf token mismatch", "method", r.Method, "uri", r.URL.RequestURI())
+			data := app.newTemplateData(r)
+			app.render(w, r, http.StatusBadRequest, "csrf.gohtml", data)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
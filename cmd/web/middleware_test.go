@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	validToken := ts.csrfToken(t, "/user/login")
+
+	tests := []struct {
+		name     string
+		field    string
+		header   string
+		wantCode int
+	}{
+		{
+			name:     "Valid field",
+			field:    validToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Valid header",
+			header:   validToken,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Missing token",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Wrong token",
+			field:    "wrongToken",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Token with extra characters",
+			field:    validToken + "x",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.field != "" {
+				form.Add("csrf_token", tt.field)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/user/login", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			code, _, body := ts.do(t, req)
+
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if rejected := strings.Contains(body, "could not be verified"); rejected != (tt.wantCode == http.StatusBadRequest) {
+				t.Errorf("got csrf error page %t; want %t", rejected, !rejected)
+			}
+		})
+	}
+}
+
+func TestCSRFProtectOtherSession(t *testing.T) {
+	app := newTestApplication(t)
+	victim := newTestServer(t, app.routes())
+	userID := victim.login(t, app, "victim@example.com")
+
+	// A token from another session, such as an attacker's own, is no good.
+	attacker := victim.newSession(t)
+	token := attacker.csrfToken(t, "/user/login")
+
+	form := url.Values{}
+	form.Add("title", "Forged")
+	form.Add("content", "Forged")
+	form.Add("expires", "7")
+	form.Add("csrf_token", token)
+
+	code, _, _ := victim.postForm(t, "/snippet/create", form)
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d; want %d", code, http.StatusBadRequest)
+	}
+
+	snippets, err := app.snippets.ByUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 0 {
+		t.Errorf("got %d snippets; want none created", len(snippets))
+	}
+
+	// The same form with the victim's own token goes through.
+	form.Set("csrf_token", victim.csrfToken(t, "/snippet/create"))
+
+	code, _, _ = victim.postForm(t, "/snippet/create", form)
+	if code != http.StatusSeeOther {
+		t.Errorf("got status %d with the session's token; want %d", code, http.StatusSeeOther)
+	}
+}
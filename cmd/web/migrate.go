@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/fayazp088/snippet-box/internal/migrations"
+)
+
+const migrateUsage = `usage: web [flags] migrate <command>
+
+Commands:
+  up         apply all pending migrations
+  down [n]   revert the last n applied migrations (default 1)
+  status     list migrations and when they were applied`
+
+// runMigrate implements the "migrate" subcommand.
+func (app *Application) runMigrate(w io.Writer, driver, dsn string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := openDatabase(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up()
+		for _, m := range done {
+			fmt.Fprintf(w, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(w, "no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		done, err := migrator.Down(steps)
+		for _, m := range done {
+			fmt.Fprintf(w, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// migrateUp applies pending migrations when the server starts with
+// -auto-migrate.
+func (app *Application) migrateUp(db *sql.DB, driver string) error {
+	migrator, err := migrations.New(db, driver)
+	if err != nil {
+		return err
+	}
+
+	done, err := migrator.Up()
+	for _, m := range done {
+		app.logger.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+
+	return err
+}
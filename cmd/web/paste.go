@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// maxPasteBytes limits the size of a snippet posted to pastePost.
+const maxPasteBytes = 1_048_576
+
+// pasteParam returns a paste option from the query string, or failing that
+// from the X-Paste-<name> header, so that scripts can use whichever is more
+// convenient.
+func pasteParam(r *http.Request, name string) string {
+	if value := r.URL.Query().Get(name); value != "" {
+		return value
+	}
+	return r.Header.Get("X-Paste-" + name)
+}
+
+// pastePost creates a snippet from the raw request body, pastebin style:
+//
+//	cat main.go | curl --data-binary @- 'https://box/?title=main.go'
+//
+// The title, expires (in days), language, tags, visibility and burn (true to
+// burn after reading) options are read by pasteParam. A passphrase can only
+// be sent in the X-Paste-Passphrase header, to keep it out of URLs and access
+// logs. The response is the URL of the new snippet as plain text.
+//
+// Requests must carry a write-scoped API token unless anonymous pasting is
+// turned on, in which case requests without a token are pasted as the
+// anonymous user.
+func (app *Application) pastePost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+	if userID == 0 {
+		userID = app.anonymousUserID
+	}
+	if userID == 0 {
+		http.Error(w, "an API token is required to paste (Authorization: Bearer <token>)", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPasteBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, fmt.Sprintf("the paste must not be larger than %d bytes", maxBytesError.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !utf8.Valid(body) {
+		http.Error(w, "the paste must be UTF-8 text", http.StatusUnprocessableEntity)
+		return
+	}
+
+	form := snippetCreateForm{
+		Title:      pasteParam(r, "title"),
+		Content:    string(body),
+		Language:   pasteParam(r, "language"),
+		Visibility: pasteParam(r, "visibility"),
+		Expires:    7,
+		Tags:       []string{pasteParam(r, "tags")},
+		Passphrase: r.Header.Get("X-Paste-Passphrase"),
+	}
+
+	if form.Title == "" {
+		form.Title = "Untitled paste"
+	}
+
+	if expires := pasteParam(r, "expires"); expires != "" {
+		form.Expires, err = strconv.Atoi(expires)
+		if err != nil {
+			form.Expires = -1
+		}
+	}
+
+	var burnErr error
+	if burn := pasteParam(r, "burn"); burn != "" {
+		form.BurnAfterReading, burnErr = strconv.ParseBool(burn)
+	}
+
+	form.validate()
+
+	form.CheckField(burnErr == nil, "burn", "This field must be true or false")
+
+	// Nobody can sign in as the anonymous user, so nobody could ever see an
+	// anonymous private paste.
+	form.CheckField(userID != app.anonymousUserID || form.Visibility != models.VisibilityPrivate, "visibility", "Anonymous pastes cannot be private")
+
+	if !form.Valid() {
+		fields := make([]string, 0, len(form.FieldErrors))
+		for field := range form.FieldErrors {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		var msg strings.Builder
+		for _, field := range fields {
+			fmt.Fprintf(&msg, "%s: %s\n", field, form.FieldErrors[field])
+		}
+		http.Error(w, msg.String(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	id, err := app.snippets.Insert(userID, form.input())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	snippet, err := app.snippets.Get(id, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	path := "/snippet/view/" + snippet.Key()
+
+	w.Header().Set("Location", path)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintln(w, absoluteURL(r, path))
+}
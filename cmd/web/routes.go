@@ -12,19 +12,66 @@ func (app *Application) routes() http.Handler {
 
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
+	router.HandlerFunc(http.MethodGet, "/highlight/:file", app.highlightCSS)
 
-	dynamic := alice.New(app.sessionManager.LoadAndSave)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.csrfProtect, app.authenticate)
 
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
+	router.Handler(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
+	router.Handler(http.MethodGet, "/search", dynamic.ThenFunc(app.snippetSearch))
+	router.Handler(http.MethodGet, "/tags", dynamic.ThenFunc(app.tagCloud))
+	router.Handler(http.MethodPost, "/theme", dynamic.ThenFunc(app.themePost))
+	router.Handler(http.MethodGet, "/tag/:name", dynamic.ThenFunc(app.tagView))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
-	router.Handler(http.MethodGet, "/snippet/create", dynamic.ThenFunc(app.snippetCreate))
-	router.Handler(http.MethodPost, "/snippet/create", dynamic.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/view/:id/history", dynamic.ThenFunc(app.snippetHistory))
+	router.Handler(http.MethodGet, "/snippet/view/:id/diff", dynamic.ThenFunc(app.snippetDiff))
+	router.Handler(http.MethodGet, "/snippet/raw/:id", dynamic.ThenFunc(app.snippetRaw))
+	router.Handler(http.MethodGet, "/snippet/download/:id", dynamic.ThenFunc(app.snippetDownload))
+	router.Handler(http.MethodPost, "/snippet/unlock/:id", dynamic.ThenFunc(app.snippetUnlockPost))
+	router.Handler(http.MethodPost, "/snippet/burn/:id", dynamic.ThenFunc(app.snippetBurnPost))
 
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
-	router.Handler(http.MethodPost, "/user/logout", dynamic.ThenFunc(app.userLogoutPost))
+
+	protected := dynamic.Append(app.requireAuthentication)
+
+	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	router.Handler(http.MethodGet, "/snippet/edit/:id", protected.ThenFunc(app.snippetEdit))
+	router.Handler(http.MethodPost, "/snippet/edit/:id", protected.ThenFunc(app.snippetEditPost))
+	router.Handler(http.MethodPost, "/snippet/delete/:id", protected.ThenFunc(app.snippetDeletePost))
+	router.Handler(http.MethodPost, "/snippet/restore/:id", protected.ThenFunc(app.snippetRestorePost))
+
+	router.Handler(http.MethodGet, "/user/snippets", protected.ThenFunc(app.userSnippets))
+	router.Handler(http.MethodGet, "/user/tokens", protected.ThenFunc(app.userTokens))
+	router.Handler(http.MethodPost, "/user/tokens", protected.ThenFunc(app.userTokensPost))
+	router.Handler(http.MethodPost, "/user/tokens/revoke/:id", protected.ThenFunc(app.userTokenRevokePost))
+	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
+
+	// The JSON API shares the session with the HTML pages but skips
+	// csrfProtect: write requests must carry an application/json body (or use
+	// DELETE), neither of which a cross-site page can send without a CORS
+	// preflight that we never approve. Non-browser clients authenticate with
+	// a personal API token instead of the session cookie.
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.authenticateToken)
+
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	router.Handler(http.MethodGet, "/api/v1/search", api.ThenFunc(app.apiSnippetSearch))
+
+	apiProtected := api.Append(app.requireAPIAuthentication, app.requireWriteScope)
+
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetDelete))
+
+	// Pastes are raw request bodies, which any cross-site form could send,
+	// so they only accept API tokens and never look at the session cookie.
+	paste := alice.New(app.authenticateToken, app.requireWriteScope)
+
+	router.Handler(http.MethodPost, "/", paste.ThenFunc(app.pastePost))
 
 	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
 	return standard.Then(router)
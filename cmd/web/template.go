@@ -1,26 +1,126 @@
 package main
 
 import (
+	"fmt"
+	"html/template"
+	"math"
 	"path/filepath"
-	"text/template"
 	"time"
 
+	"github.com/fayazp088/snippet-box/internal/diff"
+	"github.com/fayazp088/snippet-box/internal/highlight"
+	"github.com/fayazp088/snippet-box/internal/markdown"
 	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/fayazp088/snippet-box/internal/search"
 )
 
 type templateData struct {
-	CurrentYear int
-	Snippet     models.Snippet
-	Snippets    []models.Snippet
-	Form        any
-	Flash       string
+	CurrentYear     int
+	Snippet         models.Snippet
+	Snippets        []models.Snippet
+	Form            any
+	Flash           string
+	IsAuthenticated bool
+	CSRFToken       string
+	CanModify       bool
+	Revisions       []models.Revision
+	Diff            diffData
+	Tokens          []models.Token
+	NewToken        string
+	Pagination      pagination
+	SearchResults   []searchResult
+	TagCloud        []tagCloudEntry
+	Languages       []highlight.Language
+	Theme           string
+	Themes          []string
+	ShowSource      bool
+	Preview         bool
+	BurnedNow       bool
+}
+
+// tagCloudEntry is a tag in the tag cloud. Size runs from 1 to 5 depending on
+// how often the tag is used compared with the most popular tag.
+type tagCloudEntry struct {
+	models.TagCount
+	Size int
+}
+
+func newTagCloud(counts []models.TagCount) []tagCloudEntry {
+	most := 1
+	for _, c := range counts {
+		most = max(most, c.Count)
+	}
+
+	cloud := make([]tagCloudEntry, 0, len(counts))
+	for _, c := range counts {
+		size := 1
+		if most > 1 {
+			size += int(4 * math.Log(float64(c.Count)) / math.Log(float64(most)))
+		}
+		cloud = append(cloud, tagCloudEntry{TagCount: c, Size: size})
+	}
+
+	return cloud
+}
+
+// searchResult is a search match prepared for display, with the query terms
+// highlighted in the title and in an excerpt of the content.
+type searchResult struct {
+	models.SearchResult
+	HighlightedTitle []search.Fragment
+	Excerpt          []search.Fragment
+}
+
+func newSearchResults(results []models.SearchResult, query string) []searchResult {
+	terms := search.Terms(query)
+
+	display := make([]searchResult, 0, len(results))
+	for _, r := range results {
+		display = append(display, searchResult{
+			SearchResult:     r,
+			HighlightedTitle: search.Highlight(r.Title, terms),
+			Excerpt:          search.Excerpt(r.Content, terms, 160),
+		})
+	}
+
+	return display
+}
+
+// pagination holds the links rendered by the pagination partial. PrevURL and
+// NextURL are empty on the first and last pages.
+type pagination struct {
+	Page     int
+	LastPage int
+	Total    int
+	PrevURL  string
+	NextURL  string
+}
+
+// diffData holds the two revisions being compared on the diff page and the
+// hunks that separate them.
+type diffData struct {
+	From  models.Revision
+	To    models.Revision
+	Hunks []diff.Hunk
 }
 
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":    humanDate,
+	"highlight":    highlight.HTML,
+	"languageName": highlight.LanguageName,
+	"markdown":     markdown.Render,
+	"percent":      percent,
+}
+
+// percent formats a fraction between 0 and 1 as a whole percentage.
+func percent(f float64) string {
+	return fmt.Sprintf("%.0f%%", f*100)
 }
 
 func humanDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/go-playground/form"
+)
+
+// TestMain runs the tests from the repository root, where the templates are
+// found when the server runs.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestApplication returns an Application backed by the in-memory store.
+func newTestApplication(t *testing.T) *Application {
+	t.Helper()
+
+	tmplCache, err := templateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Secure = true
+
+	app := &Application{
+		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		templteCache:   tmplCache,
+		formDecoder:    form.NewDecoder(),
+		sessionManager: sessionManager,
+		unlockAttempts: newAttemptLimiter(maxUnlockAttempts, unlockAttemptWindow),
+	}
+
+	if _, err := app.openStores("memory", "", false, models.DefaultSlugLength, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+// testServer is a TLS test server with a client that keeps cookies, so that
+// it has a session of its own, and does not follow redirects.
+type testServer struct {
+	*httptest.Server
+	client *http.Client
+}
+
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	return (&testServer{Server: ts}).newSession(t)
+}
+
+// newSession returns a client for the same server that starts a new
+// session.
+func (ts *testServer) newSession(t *testing.T) *testServer {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{
+		Transport: ts.Server.Client().Transport,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &testServer{Server: ts.Server, client: client}
+}
+
+func (ts *testServer) do(t *testing.T, req *http.Request) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ts.do(t, req)
+}
+
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return ts.do(t, req)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+?)" />`)
+
+// csrfToken fetches a page and returns the CSRF token from its forms.
+func (ts *testServer) csrfToken(t *testing.T, urlPath string) string {
+	t.Helper()
+
+	_, _, body := ts.get(t, urlPath)
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatalf("no csrf token found in %s", urlPath)
+	}
+
+	return html.UnescapeString(matches[1])
+}
+
+// testPassword is the password of users made by newTestUser.
+const testPassword = "pa$$word123"
+
+// newTestUser adds a user with the given email address and returns their ID.
+func newTestUser(t *testing.T, app *Application, email string) int {
+	t.Helper()
+
+	if err := app.users.Insert("Test User", email, testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := app.users.Authenticate(email, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// login creates a user and logs the test client in as them, returning the
+// user's ID.
+func (ts *testServer) login(t *testing.T, app *Application, email string) int {
+	t.Helper()
+
+	id := newTestUser(t, app, email)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", testPassword)
+	form.Add("csrf_token", ts.csrfToken(t, "/user/login"))
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("logging in: got status %d; want %d", code, http.StatusSeeOther)
+	}
+
+	return id
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/fayazp088/snippet-box/internal/validator"
+)
+
+// passphraseHeader carries the passphrase of a protected snippet on requests
+// from the API and command-line tools, which have no unlock form.
+const passphraseHeader = "X-Snippet-Passphrase"
+
+// Passphrase guesses are limited per client address and snippet.
+const (
+	maxUnlockAttempts   = 5
+	unlockAttemptWindow = 15 * time.Minute
+)
+
+// maxUnlockGrants bounds the number of snippets a session remembers having
+// unlocked. The oldest are forgotten first.
+const maxUnlockGrants = 50
+
+var (
+	errPassphraseRequired  = errors.New("this snippet is protected by a passphrase; send it in the " + passphraseHeader + " header")
+	errPassphraseIncorrect = errors.New("the passphrase is incorrect")
+)
+
+// tooManyAttemptsError is returned once a client has guessed a snippet's
+// passphrase wrongly too often. RetryAfter is how long until it may try again.
+type tooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e tooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many incorrect passphrases; try again in %d seconds", retryAfterSeconds(e.RetryAfter))
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, as a Retry-After
+// header needs.
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type snippetUnlockForm struct {
+	Passphrase          string `form:"passphrase"`
+	Next                string `form:"next"`
+	validator.Validator `form:"-"`
+}
+
+// unlockGrant identifies a snippet unlocked in a session. It includes a hash
+// of the snippet's passphrase hash, so that changing the passphrase locks out
+// everyone who unlocked the snippet with the old one.
+func unlockGrant(snippet models.Snippet) string {
+	sum := sha256.Sum256(snippet.HashedPassphrase)
+	return strconv.Itoa(snippet.ID) + ":" + hex.EncodeToString(sum[:8])
+}
+
+func (app *Application) unlockGrants(r *http.Request) []string {
+	grants, _ := app.sessionManager.Get(r.Context(), "unlockedSnippets").([]string)
+	return grants
+}
+
+// grantUnlock remembers in the session that the snippet has been unlocked.
+func (app *Application) grantUnlock(r *http.Request, snippet models.Snippet) {
+	grant := unlockGrant(snippet)
+
+	grants := app.unlockGrants(r)
+	if slices.Contains(grants, grant) {
+		return
+	}
+
+	grants = append(grants, grant)
+	if len(grants) > maxUnlockGrants {
+		grants = grants[len(grants)-maxUnlockGrants:]
+	}
+
+	app.sessionManager.Put(r.Context(), "unlockedSnippets", grants)
+}
+
+// checkUnlocked returns nil if the current request may see the content of the
+// snippet. Snippets without a passphrase are open to anyone who can see them,
+// and protected ones to users who may modify them and sessions that have
+// unlocked them. Other requests must carry the passphrase in the
+// X-Snippet-Passphrase header, or get errPassphraseRequired.
+func (app *Application) checkUnlocked(r *http.Request, snippet models.Snippet) error {
+	if !snippet.Protected() || slices.Contains(app.unlockGrants(r), unlockGrant(snippet)) {
+		return nil
+	}
+
+	canModify, err := app.canModify(r, snippet)
+	if err != nil {
+		return err
+	}
+	if canModify {
+		return nil
+	}
+
+	passphrase := r.Header.Get(passphraseHeader)
+	if passphrase == "" {
+		return errPassphraseRequired
+	}
+
+	return app.tryPassphrase(r, snippet, passphrase)
+}
+
+// tryPassphrase checks a guess at a snippet's passphrase, returning
+// errPassphraseIncorrect if it is wrong and a tooManyAttemptsError if the
+// client has run out of guesses.
+func (app *Application) tryPassphrase(r *http.Request, snippet models.Snippet, passphrase string) error {
+	key := clientIP(r) + " " + strconv.Itoa(snippet.ID)
+
+	ok, retryAfter := app.unlockAttempts.Attempt(key)
+	if !ok {
+		return tooManyAttemptsError{RetryAfter: retryAfter}
+	}
+
+	err := snippet.CheckPassphrase(passphrase)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return errPassphraseIncorrect
+		}
+		return err
+	}
+
+	app.unlockAttempts.Reset(key)
+
+	return nil
+}
+
+// unlockStatus returns the status code of the response to a request that
+// checkUnlocked or tryPassphrase turned away with err, setting the
+// Retry-After header if the client must wait. It returns 0 for errors that
+// are the server's fault.
+func unlockStatus(w http.ResponseWriter, err error) int {
+	var tooMany tooManyAttemptsError
+
+	switch {
+	case errors.Is(err, errPassphraseRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, errPassphraseIncorrect):
+		return http.StatusForbidden
+	case errors.As(err, &tooMany):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(tooMany.RetryAfter)))
+		return http.StatusTooManyRequests
+	default:
+		return 0
+	}
+}
+
+// acceptsHTML reports whether the client asked for an HTML page, as browsers
+// do. Tools like curl send no Accept header or */*, and get plain text.
+func acceptsHTML(r *http.Request) bool {
+	return responseFormat(r) == formatHTML && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// requireUnlocked checks that the current request may see the content of the
+// snippet. If not, browsers have been shown the unlock form, other clients
+// sent a plain text error, and ok is false.
+func (app *Application) requireUnlocked(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (ok bool) {
+	err := app.checkUnlocked(r, snippet)
+	if err == nil {
+		// Whoever unlocked it, the content must not be kept by shared caches.
+		if snippet.Protected() {
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+		return true
+	}
+
+	status := unlockStatus(w, err)
+	if status == 0 {
+		app.serverError(w, r, err)
+		return false
+	}
+
+	if !acceptsHTML(r) {
+		http.Error(w, err.Error(), status)
+		return false
+	}
+
+	form := snippetUnlockForm{Next: r.URL.RequestURI()}
+	if status != http.StatusUnauthorized {
+		form.AddNonFieldError(unlockErrorMessage(err))
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+	app.render(w, r, status, "unlock.gohtml", data)
+
+	return false
+}
+
+// unlockErrorMessage words an error from tryPassphrase for the unlock form.
+func unlockErrorMessage(err error) string {
+	var tooMany tooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		minutes := int(math.Ceil(tooMany.RetryAfter.Minutes()))
+		if minutes == 1 {
+			return "Too many incorrect passphrases. Try again in a minute."
+		}
+		return fmt.Sprintf("Too many incorrect passphrases. Try again in %d minutes.", minutes)
+	}
+	return "The passphrase is incorrect"
+}
+
+func (a *Application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := a.snippetFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var form snippetUnlockForm
+	err := a.decodePostForm(r, &form)
+	if err != nil {
+		a.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	next := localRedirect(form.Next, "/snippet/view/"+snippet.Key())
+
+	if !snippet.Protected() {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Passphrase), "passphrase", "This field cannot be blank")
+
+	status := http.StatusUnprocessableEntity
+
+	if form.Valid() {
+		err = a.tryPassphrase(r, snippet, form.Passphrase)
+		if err == nil {
+			// Unlocking raises the session's privileges, like logging in.
+			err = a.sessionManager.RenewToken(r.Context())
+			if err != nil {
+				a.serverError(w, r, err)
+				return
+			}
+
+			a.grantUnlock(r, snippet)
+
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+
+		if unlockStatus(w, err) == 0 {
+			a.serverError(w, r, err)
+			return
+		}
+		if errors.As(err, new(tooManyAttemptsError)) {
+			status = http.StatusTooManyRequests
+		}
+
+		form.AddNonFieldError(unlockErrorMessage(err))
+	}
+
+	// Don't send the guess back in the form.
+	form.Passphrase = ""
+
+	data := a.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = form
+	a.render(w, r, status, "unlock.gohtml", data)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// newProtectedSnippet adds a public snippet protected by passphrase and
+// returns its key.
+func newProtectedSnippet(t *testing.T, app *Application, userID int, passphrase string) string {
+	t.Helper()
+
+	id, err := app.snippets.Insert(userID, models.SnippetInput{
+		Title:      "Protected",
+		Content:    "Secret",
+		Visibility: models.VisibilityPublic,
+		Expires:    7,
+		Passphrase: passphrase,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet, err := app.snippets.Get(id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snippet.Key()
+}
+
+// getRaw fetches the raw content of a snippet, sending passphrase in the
+// X-Snippet-Passphrase header if it is not empty.
+func (ts *testServer) getRaw(t *testing.T, key, passphrase string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/snippet/raw/"+key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != "" {
+		req.Header.Set(passphraseHeader, passphrase)
+	}
+
+	return ts.do(t, req)
+}
+
+func TestCheckUnlocked(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	author := ts.newSession(t)
+	authorID := author.login(t, app, "alice@example.com")
+
+	key := newProtectedSnippet(t, app, authorID, "correct horse")
+
+	tests := []struct {
+		name       string
+		client     *testServer
+		passphrase string
+		wantCode   int
+	}{
+		{"Author", author, "", http.StatusOK},
+		{"No passphrase", ts, "", http.StatusUnauthorized},
+		{"Wrong passphrase", ts, "battery staple", http.StatusForbidden},
+		{"Right passphrase", ts, "correct horse", http.StatusOK},
+		{"Passphrase only unlocks one request", ts, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := tt.client.getRaw(t, key, tt.passphrase)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := body == "Secret"; got != (tt.wantCode == http.StatusOK) {
+				t.Errorf("got content shown %t; want %t", got, !got)
+			}
+			if code == http.StatusOK && header.Get("Cache-Control") != "private, no-store" {
+				t.Errorf("got Cache-Control %q; want private, no-store", header.Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestCheckUnlockedSession(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	authorID := newTestUser(t, app, "alice@example.com")
+
+	key := newProtectedSnippet(t, app, authorID, "correct horse")
+
+	form := url.Values{}
+	form.Add("passphrase", "correct horse")
+	form.Add("csrf_token", ts.csrfToken(t, "/user/login"))
+
+	code, _, _ := ts.postForm(t, "/snippet/unlock/"+key, form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("unlocking: got status %d; want %d", code, http.StatusSeeOther)
+	}
+
+	if code, _, _ = ts.getRaw(t, key, ""); code != http.StatusOK {
+		t.Errorf("got status %d after unlocking; want %d", code, http.StatusOK)
+	}
+
+	if code, _, _ = ts.newSession(t).getRaw(t, key, ""); code != http.StatusUnauthorized {
+		t.Errorf("got status %d in another session; want %d", code, http.StatusUnauthorized)
+	}
+
+	// Changing the passphrase locks out sessions that knew the old one.
+	snippet, err := app.snippets.GetBySlug(key, authorID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = app.snippets.SetPassphrase(snippet.ID, "a new passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _, _ = ts.getRaw(t, key, ""); code != http.StatusUnauthorized {
+		t.Errorf("got status %d after the passphrase changed; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestCheckUnlockedAttempts(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	authorID := newTestUser(t, app, "alice@example.com")
+
+	key := newProtectedSnippet(t, app, authorID, "correct horse")
+	otherKey := newProtectedSnippet(t, app, authorID, "correct horse")
+
+	for i := 0; i < maxUnlockAttempts; i++ {
+		if code, _, _ := ts.getRaw(t, key, "wrong guess"); code != http.StatusForbidden {
+			t.Fatalf("guess %d: got status %d; want %d", i+1, code, http.StatusForbidden)
+		}
+	}
+
+	// Once the guesses are used up, even the right passphrase is refused,
+	// from any session.
+	code, header, _ := ts.newSession(t).getRaw(t, key, "correct horse")
+	if code != http.StatusTooManyRequests {
+		t.Errorf("got status %d; want %d", code, http.StatusTooManyRequests)
+	}
+	if header.Get("Retry-After") == "" {
+		t.Error("got no Retry-After header")
+	}
+
+	// Guesses are counted per snippet.
+	if code, _, _ = ts.getRaw(t, otherKey, "correct horse"); code != http.StatusOK {
+		t.Errorf("got status %d for another snippet; want %d", code, http.StatusOK)
+	}
+}
+
+func TestPassphraseNotSentBack(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	userID := ts.login(t, app, "alice@example.com")
+
+	key := newProtectedSnippet(t, app, userID, "correct horse")
+
+	tests := []struct {
+		name   string
+		path   string
+		action string
+	}{
+		{"Create with errors", "/snippet/create", ""},
+		{"Create preview", "/snippet/create", "preview"},
+		{"Edit with errors", "/snippet/edit/" + key, ""},
+		{"Edit preview", "/snippet/edit/" + key, "preview"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Title")
+			form.Add("content", "Content")
+			form.Add("expires", "7")
+			form.Add("passphrase", "my secret passphrase")
+			form.Add("csrf_token", ts.csrfToken(t, tt.path))
+			if tt.action == "" {
+				form.Set("title", "")
+			} else {
+				form.Add("action", tt.action)
+			}
+
+			code, _, body := ts.postForm(t, tt.path, form)
+			if code == http.StatusSeeOther || code == http.StatusBadRequest {
+				t.Fatalf("got status %d; want the form shown again", code)
+			}
+			if strings.Contains(body, "my secret passphrase") {
+				t.Error("got the passphrase in the page")
+			}
+			if !strings.Contains(body, "Enter the passphrase again") {
+				t.Error("got no hint to enter the passphrase again")
+			}
+		})
+	}
+}
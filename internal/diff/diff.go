@@ -0,0 +1,204 @@
+// Package diff computes line-based unified diffs between two texts.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a single line of a diff. OldNumber and NewNumber are the 1-based
+// line numbers in the old and new text; a number is 0 when the line does not
+// exist on that side.
+type Line struct {
+	Op        Op
+	Text      string
+	OldNumber int
+	NewNumber int
+}
+
+// Prefix returns the unified diff marker for the line.
+func (l Line) Prefix() string {
+	switch l.Op {
+	case Insert:
+		return "+"
+	case Delete:
+		return "-"
+	default:
+		return " "
+	}
+}
+
+// Hunk is a group of changed lines together with their surrounding context.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the "@@ -a,b +c,d @@" line for the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// MaxCells bounds the size of the table Lines builds to find the longest
+// common subsequence: one cell per pair of changed old and new lines. Past it,
+// the changed lines are reported as deleted and then inserted in one block,
+// so that diffing two large revisions can't take hundreds of megabytes.
+const MaxCells = 4_000_000
+
+// Lines returns every line of old and new marked as equal, inserted or
+// deleted, using the longest common subsequence of the two. If the lines
+// between the common prefix and suffix are too many to compare (see
+// MaxCells), they are all marked as replaced instead.
+func Lines(old, new string) []Line {
+	a := split(old)
+	b := split(new)
+
+	// Strip the common prefix and suffix before running the quadratic LCS so
+	// that small edits to large snippets stay cheap.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ma := a[prefix : len(a)-suffix]
+	mb := b[prefix : len(b)-suffix]
+
+	// With no table every changed line is deleted, then inserted: the walk
+	// below treats a nil table as having no common lines.
+	var lcs [][]int32
+	if (len(ma)+1)*(len(mb)+1) <= MaxCells {
+		lcs = make([][]int32, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(mb)+1)
+		}
+	}
+	for i := len(ma) - 1; i >= 0 && lcs != nil; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]Line, 0, len(a)+len(b))
+	oldN, newN := 0, 0
+
+	equal := func(text string) {
+		oldN++
+		newN++
+		lines = append(lines, Line{Op: Equal, Text: text, OldNumber: oldN, NewNumber: newN})
+	}
+
+	for _, text := range a[:prefix] {
+		equal(text)
+	}
+
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case lcs != nil && i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			equal(ma[i])
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs == nil || lcs[i+1][j] >= lcs[i][j+1]):
+			oldN++
+			lines = append(lines, Line{Op: Delete, Text: ma[i], OldNumber: oldN})
+			i++
+		default:
+			newN++
+			lines = append(lines, Line{Op: Insert, Text: mb[j], NewNumber: newN})
+			j++
+		}
+	}
+
+	for _, text := range a[len(a)-suffix:] {
+		equal(text)
+	}
+
+	return lines
+}
+
+// Unified groups the changes between old and new into hunks, keeping up to
+// context unchanged lines around each change. It returns nil when the texts
+// are identical.
+func Unified(old, new string, context int) []Hunk {
+	lines := Lines(old, new)
+
+	// Work out the [start, end) range of lines covered by each hunk, merging
+	// changes whose context would overlap.
+	var ranges [][2]int
+	for i, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+		start, end := max(i-context, 0), min(i+context+1, len(lines))
+		if n := len(ranges); n > 0 && start <= ranges[n-1][1] {
+			ranges[n-1][1] = end
+		} else {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+
+	// oldSeen and newSeen count the old and new lines that precede each line.
+	oldSeen := make([]int, len(lines)+1)
+	newSeen := make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldSeen[i+1], newSeen[i+1] = oldSeen[i], newSeen[i]
+		if line.Op != Insert {
+			oldSeen[i+1]++
+		}
+		if line.Op != Delete {
+			newSeen[i+1]++
+		}
+	}
+
+	hunks := make([]Hunk, 0, len(ranges))
+	for _, r := range ranges {
+		h := Hunk{
+			OldStart: oldSeen[r[0]],
+			OldLines: oldSeen[r[1]] - oldSeen[r[0]],
+			NewStart: newSeen[r[0]],
+			NewLines: newSeen[r[1]] - newSeen[r[0]],
+			Lines:    lines[r[0]:r[1]],
+		}
+		// As with diff -u, an empty side points at the line before the hunk.
+		if h.OldLines > 0 {
+			h.OldStart++
+		}
+		if h.NewLines > 0 {
+			h.NewStart++
+		}
+		hunks = append(hunks, h)
+	}
+
+	if len(hunks) == 0 {
+		return nil
+	}
+
+	return hunks
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
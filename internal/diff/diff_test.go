@@ -0,0 +1,144 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// render writes lines as a unified diff body, one marker and line per row.
+func render(lines []Line) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.Prefix() + line.Text + "\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "Identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: " a\n b\n",
+		},
+		{
+			name: "Changed line",
+			old:  "a\nb\nc",
+			new:  "a\nx\nc",
+			want: " a\n-b\n+x\n c\n",
+		},
+		{
+			name: "Inserted and deleted lines",
+			old:  "a\nb\nc\nd",
+			new:  "b\nc\ne\nd",
+			want: "-a\n b\n c\n+e\n d\n",
+		},
+		{
+			name: "From empty",
+			old:  "",
+			new:  "a\nb",
+			want: "+a\n+b\n",
+		},
+		{
+			name: "CRLF line endings",
+			old:  "a\r\nb\r\n",
+			new:  "a\nb\n",
+			want: " a\n b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := render(Lines(tt.old, tt.new))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesTooLarge(t *testing.T) {
+	// Every other line matches, but there are too many lines to compare, so
+	// everything between the common prefix (first, same) and suffix (last)
+	// is replaced wholesale.
+	var old, new strings.Builder
+	old.WriteString("first\n")
+	new.WriteString("first\n")
+	for i := 0; i < 2500; i++ {
+		old.WriteString("same\nold\n")
+		new.WriteString("same\nnew\n")
+	}
+	old.WriteString("last\n")
+	new.WriteString("last\n")
+
+	lines := Lines(old.String(), new.String())
+
+	counts := map[Op]int{}
+	for _, line := range lines {
+		counts[line.Op]++
+	}
+
+	if counts[Equal] != 3 || counts[Delete] != 4999 || counts[Insert] != 4999 {
+		t.Errorf("got %d equal, %d deleted and %d inserted lines; want 3, 4999 and 4999", counts[Equal], counts[Delete], counts[Insert])
+	}
+	if lines[0].Text != "first" || lines[len(lines)-1].Text != "last" {
+		t.Errorf("got first and last lines %q and %q; want the common prefix and suffix", lines[0].Text, lines[len(lines)-1].Text)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		context int
+		want    []string
+	}{
+		{
+			name:    "Identical",
+			old:     "a\nb",
+			new:     "a\nb",
+			context: 3,
+			want:    nil,
+		},
+		{
+			name:    "One hunk",
+			old:     "a\nb\nc",
+			new:     "a\nx\nc",
+			context: 1,
+			want:    []string{"@@ -1,3 +1,3 @@"},
+		},
+		{
+			name:    "Separate hunks",
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n9",
+			new:     "x\n2\n3\n4\n5\n6\n7\n8\ny",
+			context: 1,
+			want:    []string{"@@ -1,2 +1,2 @@", "@@ -8,2 +8,2 @@"},
+		},
+		{
+			name:    "Everything deleted",
+			old:     "a\nb",
+			new:     "",
+			context: 3,
+			want:    []string{"@@ -1,2 +0,0 @@"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, h := range Unified(tt.old, tt.new, tt.context) {
+				got = append(got, h.Header())
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got hunks %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Package envelope implements envelope encryption. Each piece of data is
+// encrypted with AES-256-GCM under its own random data key, and the data key
+// is stored alongside it, encrypted ("wrapped") by a master key that is kept
+// out of the database. Rotating a master key only means re-wrapping the data
+// keys; the data itself is left alone.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeySize is the size in bytes of master and data keys.
+const KeySize = 32
+
+var (
+	ErrNoKeys     = errors.New("envelope: no master keys given")
+	ErrUnknownKey = errors.New("envelope: data key wrapped by an unknown master key")
+	ErrDecrypt    = errors.New("envelope: message authentication failed")
+)
+
+// keyIDRX matches a master key ID. IDs appear in every wrapped data key, so
+// they are kept short and free of the ':' separator.
+var keyIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Keyring holds the master keys, by ID. The primary key wraps new data keys;
+// the others are kept to unwrap data keys that have not been rotated yet. A
+// Keyring is safe for concurrent use, and Replace swaps its keys for new ones
+// while it is in use.
+type Keyring struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeys reads master keys in the form "<id>:<base64 key>", separated by
+// newlines or commas. The first key is the primary. Blank lines and lines
+// starting with # are ignored.
+func ParseKeys(text string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+
+	entries := strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' })
+
+	for n, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		// Errors give the entry's position rather than quoting it, so that
+		// a typo doesn't write the key to the logs.
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found || !keyIDRX.MatchString(id) {
+			return nil, fmt.Errorf("envelope: master key entry %d is not <id>:<base64 key>, where the ID is letters, digits, '.', '_' or '-'", n+1)
+		}
+		if _, exists := k.keys[id]; exists {
+			return nil, fmt.Errorf("envelope: master key %q given twice", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("envelope: master key %q must be %d bytes, base64 encoded", id, KeySize)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.primary == "" {
+			k.primary = id
+		}
+		k.keys[id] = aead
+	}
+
+	if k.primary == "" {
+		return nil, ErrNoKeys
+	}
+
+	return k, nil
+}
+
+// GenerateKey returns a new random master key with the given ID, in the form
+// ParseKeys reads.
+func GenerateKey(id string) (string, error) {
+	if !keyIDRX.MatchString(id) {
+		return "", fmt.Errorf("envelope: invalid master key ID %q: use letters, digits, '.', '_' or '-'", id)
+	}
+
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return id + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Primary returns the ID of the master key that wraps new data keys.
+func (k *Keyring) Primary() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.primary
+}
+
+// IDs returns the IDs of the master keys held by k, sorted.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Replace swaps the keys held by k for those held by other, so that a running
+// server can pick up a new primary key without restarting.
+func (k *Keyring) Replace(other *Keyring) {
+	other.mu.RLock()
+	primary, keys := other.primary, other.keys
+	other.mu.RUnlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.primary, k.keys = primary, keys
+}
+
+// NewDataKey generates a random data key, returning it along with the key
+// wrapped by the primary master key for storage.
+func (k *Keyring) NewDataKey() (DataKey, string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return DataKey{}, "", err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return DataKey{}, "", err
+	}
+
+	wrapped, err := k.wrap(key)
+	if err != nil {
+		return DataKey{}, "", err
+	}
+
+	return DataKey{aead: aead}, wrapped, nil
+}
+
+// Unwrap decrypts a data key wrapped by NewDataKey or Rewrap.
+func (k *Keyring) Unwrap(wrapped string) (DataKey, error) {
+	key, err := k.unwrap(wrapped)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return DataKey{}, err
+	}
+
+	return DataKey{aead: aead}, nil
+}
+
+// Rewrap wraps a data key again with the primary master key. Keys already
+// wrapped by the primary are returned unchanged.
+func (k *Keyring) Rewrap(wrapped string) (string, error) {
+	if WrappedBy(wrapped) == k.Primary() {
+		return wrapped, nil
+	}
+
+	key, err := k.unwrap(wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	return k.wrap(key)
+}
+
+// WrappedBy returns the ID of the master key that wrapped a data key.
+func WrappedBy(wrapped string) string {
+	id, _, _ := strings.Cut(wrapped, ":")
+	return id
+}
+
+func (k *Keyring) wrap(key []byte) (string, error) {
+	k.mu.RLock()
+	id, aead := k.primary, k.keys[k.primary]
+	k.mu.RUnlock()
+
+	sealed, err := seal(aead, key)
+	if err != nil {
+		return "", err
+	}
+
+	return id + ":" + sealed, nil
+}
+
+func (k *Keyring) unwrap(wrapped string) ([]byte, error) {
+	id, sealed, _ := strings.Cut(wrapped, ":")
+
+	k.mu.RLock()
+	aead, ok := k.keys[id]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	return open(aead, sealed)
+}
+
+// DataKey encrypts and decrypts the data it was generated for.
+type DataKey struct {
+	aead cipher.AEAD
+}
+
+// Seal encrypts plaintext, returning the random nonce and the ciphertext,
+// base64 encoded.
+func (d DataKey) Seal(plaintext string) (string, error) {
+	return seal(d.aead, []byte(plaintext))
+}
+
+// Open decrypts a message encrypted by Seal.
+func (d DataKey) Open(sealed string) (string, error) {
+	plaintext, err := open(d.aead, sealed)
+	return string(plaintext), err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func open(aead cipher.AEAD, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
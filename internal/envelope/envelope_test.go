@@ -0,0 +1,281 @@
+package envelope
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestKeyring returns a keyring holding new random master keys with the
+// given IDs, the first being the primary.
+func newTestKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+
+	var lines []string
+	for _, id := range ids {
+		key, err := GenerateKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, key)
+	}
+
+	k, err := ParseKeys(strings.Join(lines, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestParseKeys(t *testing.T) {
+	key, err := GenerateKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, encoded, _ := strings.Cut(key, ":")
+
+	tests := []struct {
+		name        string
+		text        string
+		wantPrimary string
+		wantErr     bool
+	}{
+		{"One key", key, "a", false},
+		{"Newlines", "# keys\n\nb:" + encoded + "\n" + key + "\n", "b", false},
+		{"Commas", "b:" + encoded + "," + key, "b", false},
+		{"Empty", "", "", true},
+		{"Only comments", "# no keys yet\n", "", true},
+		{"No ID", encoded, "", true},
+		{"Bad ID", "a b:" + encoded, "", true},
+		{"Duplicate ID", key + "\n" + key, "", true},
+		{"Bad base64", "a:not base64!", "", true},
+		{"Short key", "a:" + encoded[:20], "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKeys(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if strings.Contains(err.Error(), encoded) {
+					t.Error("got the key in the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.Primary() != tt.wantPrimary {
+				t.Errorf("got primary %q; want %q", k.Primary(), tt.wantPrimary)
+			}
+		})
+	}
+}
+
+func TestDataKey(t *testing.T) {
+	k := newTestKeyring(t, "a")
+
+	key, wrapped, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if WrappedBy(wrapped) != "a" {
+		t.Errorf("got key wrapped by %q; want a", WrappedBy(wrapped))
+	}
+
+	for _, plaintext := range []string{"", "Hello, world", strings.Repeat("ü", 10000)} {
+		sealed, err := key.Seal(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Errorf("got plaintext %q in the sealed message", plaintext)
+		}
+
+		unwrapped, err := k.Unwrap(wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opened, err := unwrapped.Open(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opened != plaintext {
+			t.Errorf("got %q; want %q", opened, plaintext)
+		}
+	}
+
+	// Sealing the same message twice uses a new nonce each time.
+	first, _ := key.Seal("Hello")
+	second, _ := key.Seal("Hello")
+	if first == second {
+		t.Error("got the same sealed message twice")
+	}
+}
+
+func TestDataKeyOpenErrors(t *testing.T) {
+	k := newTestKeyring(t, "a")
+
+	key, _, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := key.Seal("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-3] ^= 'A' ^ 'B'
+
+	tests := []struct {
+		name   string
+		key    DataKey
+		sealed string
+	}{
+		{"Wrong key", other, sealed},
+		{"Tampered", key, string(tampered)},
+		{"Clear text", key, "Hello"},
+		{"Empty", key, ""},
+		{"Truncated", key, sealed[:8]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.key.Open(tt.sealed); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("got error %v; want ErrDecrypt", err)
+			}
+		})
+	}
+}
+
+func TestUnwrapErrors(t *testing.T) {
+	k := newTestKeyring(t, "a")
+	other := newTestKeyring(t, "a")
+
+	_, wrapped, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keys    *Keyring
+		wrapped string
+		wantErr error
+	}{
+		{"Unknown key ID", newTestKeyring(t, "b"), wrapped, ErrUnknownKey},
+		{"Wrong key with the same ID", other, wrapped, ErrDecrypt},
+		{"Not wrapped", k, "a:not a wrapped key", ErrDecrypt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.keys.Unwrap(tt.wrapped); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, err := GenerateKey("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := GenerateKey("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(t *testing.T, text string) *Keyring {
+		t.Helper()
+		k, err := ParseKeys(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	key, wrapped, err := parse(t, oldKey).NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := key.Seal("Hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new primary key is brought in, keeping the old one to unwrap with.
+	k := parse(t, newKey+"\n"+oldKey)
+
+	if _, err = k.Unwrap(wrapped); err != nil {
+		t.Fatalf("unwrapping with the old key: %v", err)
+	}
+
+	rewrapped, err := k.Rewrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if WrappedBy(rewrapped) != "new" {
+		t.Fatalf("got key wrapped by %q; want new", WrappedBy(rewrapped))
+	}
+
+	again, err := k.Rewrap(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != rewrapped {
+		t.Error("got a key already wrapped by the primary wrapped again")
+	}
+
+	// Once the old key is retired, only the rewrapped key can be unwrapped,
+	// and it still opens the content sealed before the rotation.
+	k = parse(t, newKey)
+
+	if _, err = k.Unwrap(wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got error %v unwrapping with a retired key; want ErrUnknownKey", err)
+	}
+
+	unwrapped, err := k.Unwrap(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := unwrapped.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != "Hello" {
+		t.Errorf("got %q; want Hello", opened)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	k := newTestKeyring(t, "a")
+
+	_, wrapped, err := k.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k.Replace(newTestKeyring(t, "b"))
+
+	if k.Primary() != "b" {
+		t.Errorf("got primary %q; want b", k.Primary())
+	}
+	if ids := k.IDs(); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("got IDs %q; want [b]", ids)
+	}
+	if _, err := k.Unwrap(wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got error %v; want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,525 @@
+package highlight
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Confidence scores for each kind of evidence Detect looks at. Explicit hints
+// from the author outrank anything guessed from the code itself.
+const (
+	shebangConfidence   = 0.99
+	modelineConfidence  = 0.95
+	extensionConfidence = 0.9
+	jsonConfidence      = 0.9
+	maxGuessConfidence  = 0.85
+	minGuessConfidence  = 0.25
+)
+
+// maxDetectBytes bounds how much of a snippet Detect looks at. The token
+// patterns take seconds a megabyte, and the start of a snippet tells as much
+// as the rest of it.
+const maxDetectBytes = 64 << 10
+
+// Detect guesses the language of a snippet from its title and content. It
+// looks, in order, for a shebang line, an editor modeline, a file name with a
+// known extension in the title, and finally scores the content against
+// per-language token patterns. Only the first maxDetectBytes of the content
+// are scored, and modelines are looked for within that much of either end.
+// It returns the language ID and a confidence between 0 and 1, or PlainText
+// and 0 if it cannot tell.
+func Detect(title, content string) (string, float64) {
+	if lang := fromShebang(content); lang != "" {
+		return lang, shebangConfidence
+	}
+	if lang := fromModeline(content); lang != "" {
+		return lang, modelineConfidence
+	}
+	if lang := fromTitle(title); lang != "" {
+		return lang, extensionConfidence
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if json.Valid([]byte(trimmed)) {
+			return "json", jsonConfidence
+		}
+	}
+
+	return guess(head(content))
+}
+
+// head returns the start of content, at most maxDetectBytes of it, cut after
+// the last complete line if there is one so that no token is cut in two.
+func head(content string) string {
+	if len(content) <= maxDetectBytes {
+		return content
+	}
+
+	content = content[:maxDetectBytes]
+	if i := strings.LastIndexByte(content, '\n'); i >= 0 {
+		return content[:i+1]
+	}
+	return content
+}
+
+// tail returns the end of content, at most maxDetectBytes of it, starting at
+// a line break if there is one.
+func tail(content string) string {
+	if len(content) <= maxDetectBytes {
+		return content
+	}
+
+	content = content[len(content)-maxDetectBytes:]
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		return content[i+1:]
+	}
+	return content
+}
+
+// aliases maps interpreter, editor and file type names that differ from our
+// language IDs onto them.
+var aliases = map[string]string{
+	"sh":           "bash",
+	"zsh":          "bash",
+	"dash":         "bash",
+	"ksh":          "bash",
+	"shell":        "bash",
+	"shell-script": "bash",
+	"node":         "javascript",
+	"nodejs":       "javascript",
+	"js":           "javascript",
+	"deno":         "typescript",
+	"ts":           "typescript",
+	"py":           "python",
+	"rb":           "ruby",
+	"pwsh":         "powershell",
+	"ps1":          "powershell",
+	"make":         "makefile",
+	"dockerfile":   "docker",
+	"cs":           "csharp",
+	"c++":          "cpp",
+	"rs":           "rust",
+	"yml":          "yaml",
+	"kt":           "kotlin",
+	"conf":         "ini",
+	"dosini":       "ini",
+	"patch":        "diff",
+	"md":           "markdown",
+	"text":         PlainText,
+	"txt":          PlainText,
+}
+
+// normalize maps a name from a shebang, modeline or file extension onto a
+// language ID, returning "" if there is no match.
+func normalize(name string) string {
+	name = strings.ToLower(name)
+
+	if id, ok := aliases[name]; ok {
+		return id
+	}
+	if name != "" && IsLanguage(name) {
+		return name
+	}
+
+	return ""
+}
+
+// versionRX matches the version suffix of interpreter names like python3.12.
+var versionRX = regexp.MustCompile(`[\d.]+$`)
+
+func fromShebang(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "#!")
+	if !ok {
+		return ""
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = path.Base(f)
+				break
+			}
+		}
+	}
+
+	return normalize(versionRX.ReplaceAllString(interpreter, ""))
+}
+
+var (
+	vimModelineRX   = regexp.MustCompile(`\b(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w+-]+)`)
+	emacsModelineRX = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*)?([\w+-]+)\s*(?:;.*?)?-\*-`)
+)
+
+// fromModeline looks for a vim or emacs modeline in the first or last five
+// lines of content, which is where editors look for them.
+func fromModeline(content string) string {
+	first := strings.SplitN(head(content), "\n", 6)
+	if len(first) > 5 {
+		first = first[:5]
+	}
+
+	last := strings.Split(tail(content), "\n")
+	if len(last) > 5 {
+		last = last[len(last)-5:]
+	}
+
+	for _, line := range append(first, last...) {
+		for _, rx := range []*regexp.Regexp{vimModelineRX, emacsModelineRX} {
+			if m := rx.FindStringSubmatch(line); m != nil {
+				if lang := normalize(m[1]); lang != "" {
+					return lang
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// fileNames maps well-known file names without a telling extension onto
+// languages.
+var fileNames = map[string]string{
+	"dockerfile":  "docker",
+	"makefile":    "makefile",
+	"gnumakefile": "makefile",
+	"nginx.conf":  "nginx",
+	"gemfile":     "ruby",
+	"rakefile":    "ruby",
+	".bashrc":     "bash",
+	".zshrc":      "bash",
+	".profile":    "bash",
+}
+
+// extensions maps file extensions onto languages where the extension is not
+// already a language ID or alias.
+var extensions = map[string]string{
+	".bash":     "bash",
+	".h":        "c",
+	".cc":       "cpp",
+	".cxx":      "cpp",
+	".hpp":      "cpp",
+	".htm":      "html",
+	".mjs":      "javascript",
+	".cjs":      "javascript",
+	".jsx":      "javascript",
+	".tsx":      "typescript",
+	".gql":      "graphql",
+	".kts":      "kotlin",
+	".mk":       "makefile",
+	".psm1":     "powershell",
+	".cfg":      "ini",
+	".sc":       "scala",
+	".svg":      "xml",
+	".xsd":      "xml",
+	".graphqls": "graphql",
+}
+
+// fromTitle looks for a file name in the title, such as "deploy.sh" in
+// "Deploy script (deploy.sh)".
+func fromTitle(title string) string {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return strings.ContainsRune(" \t()[]{}<>,;:'\"`", r)
+	})
+
+	for i := len(words) - 1; i >= 0; i-- {
+		word := strings.ToLower(strings.TrimRight(words[i], "."))
+
+		if lang, ok := fileNames[path.Base(word)]; ok {
+			return lang
+		}
+
+		ext := path.Ext(word)
+		if ext == "" || ext == word {
+			continue
+		}
+		if lang := ExtensionLanguage(ext); lang != "" {
+			return lang
+		}
+	}
+
+	return ""
+}
+
+// ExtensionLanguage returns the language ID for a file extension such as
+// ".py", or "" if the extension is not recognised.
+func ExtensionLanguage(ext string) string {
+	ext = strings.ToLower(ext)
+	if lang, ok := extensions[ext]; ok {
+		return lang
+	}
+	return normalize(strings.TrimPrefix(ext, "."))
+}
+
+// A feature is a pattern that is characteristic of a language. Each match
+// adds weight to the language's score, up to maxFeatureMatches matches.
+type feature struct {
+	rx     *regexp.Regexp
+	weight int
+}
+
+const maxFeatureMatches = 3
+
+func features(weighted map[string]int) []feature {
+	f := make([]feature, 0, len(weighted))
+	for pattern, weight := range weighted {
+		f = append(f, feature{regexp.MustCompile(pattern), weight})
+	}
+	return f
+}
+
+// languageFeatures are the token patterns used to guess a language when the
+// author gave no hints. Patterns run in multi-line mode.
+var languageFeatures = map[string][]feature{
+	"bash": features(map[string]int{
+		`(?m)^\s*(?:if \[|then$|fi$|esac$|done$)`: 3,
+		`(?m)^\s*echo\s`:                2,
+		`(?m)^\s*export \w+=`:           2,
+		`\$\{\w+[}:]`:                   2,
+		`\|\s*(?:grep|awk|sed|xargs)\b`: 2,
+		`(?m)^\s*(?:sudo|apt-get|curl|cd|ls|mkdir|chmod) `: 1,
+	}),
+	"c": features(map[string]int{
+		`#include\s*<\w+\.h>`:           4,
+		`\bint\s+main\s*\(`:             2,
+		`\bprintf\s*\(`:                 2,
+		`\b(?:malloc|free|sizeof)\s*\(`: 3,
+		`\bstruct\s+\w+\s*\{`:           1,
+	}),
+	"cpp": features(map[string]int{
+		`#include\s*<(?:iostream|vector|string|map|memory|algorithm)>`: 5,
+		`\bstd::`:               3,
+		`\b(?:cout|cin|endl)\b`: 3,
+		`\btemplate\s*<`:        2,
+		`\bnullptr\b`:           3,
+	}),
+	"csharp": features(map[string]int{
+		`(?m)^using System`:           5,
+		`\bConsole\.Write(?:Line)?\(`: 4,
+		`\bnamespace\s+[\w.]+`:        1,
+		`\{\s*get;\s*set;\s*\}`:       4,
+	}),
+	"css": features(map[string]int{
+		`(?m)^\s*[.#]?[\w-]+(?:\s*[,>+~]?\s*[.#]?[\w-]+)*\s*\{`: 1,
+		`(?m)^\s*[\w-]+\s*:\s*[^;]+;\s*$`:                       1,
+		`@media\b`:                                              3,
+		`\b\d+(?:px|em|rem|vh|vw)\b`:                            2,
+		`#[0-9a-fA-F]{3,6}\b`:                                   1,
+	}),
+	"diff": features(map[string]int{
+		`(?m)^diff --git `:       5,
+		`(?m)^@@ .* @@`:          4,
+		`(?m)^(?:---|\+\+\+) \S`: 2,
+	}),
+	"docker": features(map[string]int{
+		`(?m)^FROM\s+\S+`: 4,
+		`(?m)^(?:RUN|CMD|ENTRYPOINT|COPY|ADD|WORKDIR|EXPOSE|ENV|ARG)\s`: 2,
+	}),
+	"go": features(map[string]int{
+		`(?m)^package\s+\w+\s*$`:                 4,
+		`\bfunc\s+(?:\(\w+\s+\*?\w+\)\s*)?\w+\(`: 3,
+		`:=`:                                     1,
+		`\bif err != nil\b`:                      4,
+		`\bfmt\.\w+\(`:                           2,
+		`(?m)^import \(`:                         3,
+	}),
+	"graphql": features(map[string]int{
+		`(?m)^\s*(?:query|mutation|subscription)\s*\w*\s*[({]`: 4,
+		`(?m)^\s*(?:type|input|enum)\s+\w+\s*\{`:               2,
+		`:\s*\[?\w+!`:                                          2,
+	}),
+	"html": features(map[string]int{
+		`(?i)<!DOCTYPE html`: 5,
+		`<(?:html|head|body|div|span|p|a|ul|li|script|link)\b[^>]*>`: 2,
+		`</(?:html|head|body|div|span|p|a|ul|li|script)>`:            1,
+	}),
+	"ini": features(map[string]int{
+		`(?m)^\[[\w .-]+\]\s*$`:     2,
+		`(?m)^[\w.-]+\s*=\s*[^"\s]`: 1,
+		`(?m)^;`:                    2,
+	}),
+	"java": features(map[string]int{
+		`\bpublic\s+static\s+void\s+main\b`: 5,
+		`\bSystem\.out\.print`:              5,
+		`(?m)^import java\.`:                5,
+		`\b(?:public|private|protected)\s+(?:final\s+)?(?:class|interface)\s+\w+`: 2,
+		`@Override\b`: 3,
+	}),
+	"javascript": features(map[string]int{
+		`\bconsole\.log\(`:          3,
+		`\b(?:const|let)\s+\w+\s*=`: 1,
+		`\bfunction\s*\w*\s*\(`:     2,
+		`=>`:                        1,
+		`\brequire\(['"]`:           3,
+		`\bmodule\.exports\b`:       4,
+		`\bdocument\.(?:getElementById|querySelector)`: 4,
+	}),
+	"json": features(map[string]int{
+		`(?m)^\s*"[\w-]+"\s*:\s*`: 2,
+	}),
+	"kotlin": features(map[string]int{
+		`\bfun\s+\w+\s*\(`:   3,
+		`\bval\s+\w+\s*[:=]`: 2,
+		`\bdata class\b`:     4,
+		`\bimport kotlin\.`:  5,
+	}),
+	"lua": features(map[string]int{
+		`\blocal\s+\w+\s*=`:   3,
+		`\blocal function\b`:  4,
+		`~=`:                  2,
+		`(?m)\bthen\s*$`:      1,
+		`(?m)^\s*end\s*$`:     1,
+		`\brequire\s*\(?["']`: 1,
+	}),
+	"makefile": features(map[string]int{
+		`(?m)^\.PHONY:`:           5,
+		`(?m)^[\w.%/-]+:(?:\s|$)`: 1,
+		`(?m)^\t\S`:               1,
+		`\$\([A-Z_]+\)`:           2,
+	}),
+	"markdown": features(map[string]int{
+		`(?m)^#{1,6} \S`:            1,
+		`(?m)^\s*[-*] \[[ xX]\] `:   4,
+		`\[[^\]\n]+\]\([^)\s]+\)`:   2,
+		"(?m)^```":                  2,
+		`(?m)^\|.*\|\s*$`:           1,
+		`(?m)^\|?\s*:?-{3,}:?\s*\|`: 3,
+		`\*\*[^*\n]+\*\*`:           1,
+	}),
+	"nginx": features(map[string]int{
+		`\bserver\s*\{`:      3,
+		`\blocation\s+[~=/]`: 3,
+		`\bproxy_pass\s`:     5,
+		`\blisten\s+\d+`:     3,
+		`\bserver_name\s`:    5,
+	}),
+	"php": features(map[string]int{
+		`<\?php`:                  5,
+		`\$\w+\s*=`:               1,
+		`\$this->`:                4,
+		`\bfunction\s+\w+\s*\(\$`: 4,
+	}),
+	"powershell": features(map[string]int{
+		`\b(?:Get|Set|New|Remove|Write|Invoke)-[A-Z]\w+`: 4,
+		`\bparam\s*\(`:       2,
+		`\$_\.`:              3,
+		`-(?:eq|ne|gt|lt)\s`: 2,
+	}),
+	"python": features(map[string]int{
+		`(?m)^\s*def\s+\w+\s*\(.*\)\s*(?:->\s*[\w\[\], ]+)?:\s*$`: 4,
+		`(?m)^from\s+[\w.]+\s+import\b`:                           4,
+		`(?m)^import\s+\w+(?:\.\w+)*\s*$`:                         2,
+		`\bself\.`:                                                2,
+		`\b__name__\b`:                                            4,
+		`(?m)^\s*elif\b`:                                          3,
+		`\bprint\(`:                                               1,
+		`(?m)^\s*class\s+\w+(?:\(.*\))?:\s*$`:                     3,
+	}),
+	"ruby": features(map[string]int{
+		`(?m)^\s*end\s*$`:              1,
+		`\bputs\b`:                     2,
+		`(?m)^\s*require\s+['"]`:       2,
+		`\.each\s+do\s*\|`:             4,
+		`\battr_(?:accessor|reader)\b`: 5,
+		`(?m)^\s*def\s+\w+[?!]?\s*$`:   2,
+	}),
+	"rust": features(map[string]int{
+		`\bfn\s+\w+\s*[<(]`:          2,
+		`\blet\s+mut\b`:              4,
+		`\b(?:println|vec|format)!`:  4,
+		`\bimpl\b`:                   2,
+		`(?m)^use\s+(?:std|crate)::`: 5,
+		`&mut\s`:                     3,
+	}),
+	"scala": features(map[string]int{
+		`\bcase class\b`:                         4,
+		`\bobject\s+\w+\s*(?:extends\b|\{)`:      3,
+		`\bdef\s+\w+\s*(?:\(.*\))?\s*:\s*\w+.*=`: 3,
+		`(?m)^import scala\.`:                    5,
+	}),
+	"sql": features(map[string]int{
+		`(?i)\bselect\b[\s\S]+?\bfrom\b`:           3,
+		`(?i)\binsert\s+into\b`:                    4,
+		`(?i)\bcreate\s+(?:table|index|view)\b`:    4,
+		`(?i)\bupdate\s+\w+\s+set\b`:               4,
+		`(?i)\b(?:where|join|group by|order by)\b`: 1,
+	}),
+	"swift": features(map[string]int{
+		`(?m)^import (?:UIKit|Foundation|SwiftUI)\b`: 5,
+		`\bguard\s+let\b`:       4,
+		`\bfunc\s+\w+\s*\(`:     1,
+		`\bvar\s+\w+\s*:\s*\w+`: 1,
+	}),
+	"toml": features(map[string]int{
+		`(?m)^\[\[?[\w.-]+\]\]?\s*$`:               2,
+		`(?m)^[\w-]+\s*=\s*["\[{]`:                 2,
+		`(?m)^[\w-]+\s*=\s*(?:true|false|\d+)\s*$`: 1,
+	}),
+	"typescript": features(map[string]int{
+		`:\s*(?:string|number|boolean|void|any)\b`: 3,
+		`\binterface\s+\w+\s*\{`:                   3,
+		`\btype\s+\w+\s*=`:                         2,
+		`(?m)^import\s+.*\s+from\s+['"]`:           1,
+		`\b(?:public|private|readonly)\s+\w+\s*:`:  2,
+	}),
+	"xml": features(map[string]int{
+		`<\?xml\b`:          5,
+		`</[\w:]+>`:         1,
+		`\bxmlns(?::\w+)?=`: 3,
+	}),
+	"yaml": features(map[string]int{
+		`(?m)^---\s*$`:              2,
+		`(?m)^\s*[\w-]+:\s+\S`:      1,
+		`(?m)^\s*[\w-]+:\s*$`:       1,
+		`(?m)^\s*- \S`:              1,
+		`(?m)^(?:apiVersion|kind):`: 4,
+	}),
+}
+
+// guess scores content against languageFeatures. The confidence combines how
+// far the best language is ahead of the rest with how much evidence there is
+// for it at all.
+func guess(content string) (string, float64) {
+	best, bestScore, total := "", 0, 0
+
+	for lang, feats := range languageFeatures {
+		score := 0
+		for _, f := range feats {
+			n := len(f.rx.FindAllStringIndex(content, maxFeatureMatches))
+			score += n * f.weight
+		}
+
+		total += score
+
+		// Break ties on the ID so that the result doesn't depend on map
+		// iteration order.
+		if score > bestScore || (score == bestScore && score > 0 && lang < best) {
+			best, bestScore = lang, score
+		}
+	}
+
+	if bestScore == 0 {
+		return PlainText, 0
+	}
+
+	share := float64(bestScore) / float64(total)
+	strength := min(float64(bestScore)/12, 1)
+	confidence := maxGuessConfidence * share * strength
+
+	if confidence < minGuessConfidence {
+		return PlainText, 0
+	}
+
+	return best, confidence
+}
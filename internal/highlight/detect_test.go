@@ -0,0 +1,134 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+const goCode = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	data, err := os.ReadFile("x")
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(len(data))
+}
+`
+
+const pythonCode = `from collections import Counter
+
+class Tally:
+    def __init__(self):
+        self.counts = Counter()
+
+    def add(self, word):
+        self.counts[word] += 1
+
+if __name__ == "__main__":
+    print(Tally())
+`
+
+const sqlCode = `CREATE TABLE users (id INTEGER PRIMARY KEY);
+INSERT INTO users (id) VALUES (1);
+SELECT id FROM users WHERE id = 1;
+`
+
+func TestDetect(t *testing.T) {
+	filler := strings.Repeat("Lorem ipsum dolor sit amet.\n", maxDetectBytes/28+1)
+
+	tests := []struct {
+		name     string
+		title    string
+		content  string
+		wantLang string
+		wantConf float64
+	}{
+		// Shebangs.
+		{"Shebang", "", "#!/bin/sh\necho hi\n", "bash", shebangConfidence},
+		{"Shebang with env", "", "#!/usr/bin/env python3\nprint(1)\n", "python", shebangConfidence},
+		{"Shebang with env flags", "", "#!/usr/bin/env -S node --no-warnings\nconsole.log(1)\n", "javascript", shebangConfidence},
+		{"Shebang with version", "", "#!/usr/local/bin/python3.12\n", "python", shebangConfidence},
+		{"Shebang beats title", "run.py", "#!/bin/bash\necho hi\n", "bash", shebangConfidence},
+		{"Unknown interpreter", "", "#!/usr/bin/awk -f\n{ print }\n", PlainText, 0},
+
+		// Modelines.
+		{"Vim modeline at the end", "", "puts 1\n# vim: set ft=ruby:\n", "ruby", modelineConfidence},
+		{"Emacs modeline at the start", "", "# -*- mode: python -*-\nx = 1\n", "python", modelineConfidence},
+		{"Emacs short modeline", "", "-*- lua -*-\n", "lua", modelineConfidence},
+		{"Modeline beats title", "notes.txt", "// vim: ft=go\n", "go", modelineConfidence},
+		{"Modeline in the middle", "", strings.Repeat("x\n", 6) + "# vim: ft=ruby\n" + strings.Repeat("x\n", 6), PlainText, 0},
+		{"Modeline after a long start", "", filler + "# vim: ft=ruby\n", "ruby", modelineConfidence},
+		{"Modeline before a long end", "", "# vim: ft=ruby\n" + filler, "ruby", modelineConfidence},
+
+		// File names in the title.
+		{"Title extension", "deploy.sh", "whatever", "bash", extensionConfidence},
+		{"Title extension in brackets", "Config (app.yml)", "whatever", "yaml", extensionConfidence},
+		{"Title extension alias", "main.rs", "whatever", "rust", extensionConfidence},
+		{"Title extension mapped", "App.tsx", "whatever", "typescript", extensionConfidence},
+		{"Title file name", "Dockerfile", "whatever", "docker", extensionConfidence},
+		{"Title trailing dot", "See main.go.", "whatever", "go", extensionConfidence},
+		{"Title without a file name", "My notes.", "whatever", PlainText, 0},
+
+		// JSON.
+		{"JSON object", "", `{"name": "box", "tags": [1, 2]}`, "json", jsonConfidence},
+		{"JSON array", "", "  [1, 2, 3]\n", "json", jsonConfidence},
+		{"Invalid JSON", "", `{"name": }`, PlainText, 0},
+
+		// Token patterns.
+		{"Go", "", goCode, "go", -1},
+		{"Python", "", pythonCode, "python", -1},
+		{"SQL", "", sqlCode, "sql", -1},
+		{"Code past the limit", "", filler + goCode, PlainText, 0},
+
+		// Too little evidence.
+		{"Plain text", "", "Buy eggs, milk and bread.\nCall Sam at five.\n", PlainText, 0},
+		{"One weak match", "", "a := b\n", PlainText, 0},
+		{"Empty", "", "", PlainText, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang, conf := Detect(tt.title, tt.content)
+			if lang != tt.wantLang {
+				t.Errorf("got language %q; want %q", lang, tt.wantLang)
+			}
+
+			// Guesses from the content have a confidence that depends on the
+			// evidence, so only its range is checked.
+			if tt.wantConf < 0 {
+				if conf < minGuessConfidence || conf > maxGuessConfidence {
+					t.Errorf("got confidence %v; want between %v and %v", conf, minGuessConfidence, maxGuessConfidence)
+				}
+			} else if conf != tt.wantConf {
+				t.Errorf("got confidence %v; want %v", conf, tt.wantConf)
+			}
+		})
+	}
+}
+
+func TestHeadAndTail(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	content := strings.Repeat(line, maxDetectBytes/len(line)*2)
+
+	h, tl := head(content), tail(content)
+
+	if len(h) > maxDetectBytes || len(tl) > maxDetectBytes {
+		t.Fatalf("got head of %d bytes and tail of %d; want at most %d", len(h), len(tl), maxDetectBytes)
+	}
+	if !strings.HasPrefix(content, h) || !strings.HasSuffix(h, "\n") {
+		t.Error("got a head that isn't whole lines from the start")
+	}
+	if !strings.HasSuffix(content, tl) || !strings.HasPrefix(tl, "x") || len(tl)%len(line) != 0 {
+		t.Error("got a tail that isn't whole lines from the end")
+	}
+
+	if short := "a\nb"; head(short) != short || tail(short) != short {
+		t.Error("got short content cut")
+	}
+}
@@ -0,0 +1,194 @@
+// Package highlight renders snippet content as syntax-highlighted HTML.
+//
+// Highlighted code is marked up with CSS classes rather than inline styles,
+// so that pages keep working under a Content-Security-Policy that only allows
+// stylesheets from our own origin. The colours come from a per-theme
+// stylesheet produced by CSS.
+package highlight
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"slices"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Language is a language offered in the language picker. ID is the value
+// stored with a snippet, and Extension the file extension used when a
+// snippet is downloaded.
+type Language struct {
+	ID        string
+	Name      string
+	Extension string
+}
+
+// PlainText is the ID of the language used for text that is not code.
+// Snippets stored with an empty language are also shown as plain text.
+const PlainText = "plaintext"
+
+// Languages lists the languages that snippets can be highlighted as, in the
+// order they are offered.
+var Languages = []Language{
+	{PlainText, "Plain text", ".txt"},
+	{"bash", "Bash", ".sh"},
+	{"c", "C", ".c"},
+	{"cpp", "C++", ".cpp"},
+	{"csharp", "C#", ".cs"},
+	{"css", "CSS", ".css"},
+	{"diff", "Diff", ".diff"},
+	{"docker", "Dockerfile", ".dockerfile"},
+	{"go", "Go", ".go"},
+	{"graphql", "GraphQL", ".graphql"},
+	{"html", "HTML", ".html"},
+	{"ini", "INI", ".ini"},
+	{"java", "Java", ".java"},
+	{"javascript", "JavaScript", ".js"},
+	{"json", "JSON", ".json"},
+	{"kotlin", "Kotlin", ".kt"},
+	{"lua", "Lua", ".lua"},
+	{"makefile", "Makefile", ".mk"},
+	{"markdown", "Markdown", ".md"},
+	{"nginx", "Nginx", ".conf"},
+	{"php", "PHP", ".php"},
+	{"powershell", "PowerShell", ".ps1"},
+	{"python", "Python", ".py"},
+	{"ruby", "Ruby", ".rb"},
+	{"rust", "Rust", ".rs"},
+	{"scala", "Scala", ".scala"},
+	{"sql", "SQL", ".sql"},
+	{"swift", "Swift", ".swift"},
+	{"toml", "TOML", ".toml"},
+	{"typescript", "TypeScript", ".ts"},
+	{"xml", "XML", ".xml"},
+	{"yaml", "YAML", ".yaml"},
+}
+
+// Themes lists the colour themes users can choose from. The first is the
+// default.
+var Themes = []string{
+	"github",
+	"github-dark",
+	"monokai",
+	"dracula",
+	"nord",
+	"solarized-light",
+	"solarized-dark",
+}
+
+// DefaultTheme is used until a user picks a theme.
+var DefaultTheme = Themes[0]
+
+// MaxBytes is the size above which code is not highlighted. The lexers take
+// seconds a megabyte, far too long to spend on every view of a snippet, so
+// larger code is shown as escaped plain text instead.
+const MaxBytes = 64 << 10
+
+// IsLanguage reports whether id is one of Languages.
+func IsLanguage(id string) bool {
+	return slices.ContainsFunc(Languages, func(l Language) bool { return l.ID == id })
+}
+
+// IsTheme reports whether name is one of Themes.
+func IsTheme(name string) bool {
+	return slices.Contains(Themes, name)
+}
+
+// LanguageName returns the display name of a language ID.
+func LanguageName(id string) string {
+	if id == "" {
+		id = PlainText
+	}
+
+	for _, l := range Languages {
+		if l.ID == id {
+			return l.Name
+		}
+	}
+	return id
+}
+
+// Extension returns the file extension for a language ID, including the
+// leading dot. Unknown languages get the extension of plain text.
+func Extension(id string) string {
+	for _, l := range Languages {
+		if l.ID == id {
+			return l.Extension
+		}
+	}
+	return Languages[0].Extension
+}
+
+var formatter = html.New(
+	html.WithClasses(true),
+	html.WithLineNumbers(true),
+	html.LineNumbersInTable(true),
+	html.WithLinkableLineNumbers(true, "L"),
+	html.TabWidth(4),
+)
+
+// blockFormatter renders code blocks embedded in other content, such as the
+// fenced code in Markdown, which are short enough to need no line numbers.
+var blockFormatter = html.New(
+	html.WithClasses(true),
+	html.TabWidth(4),
+)
+
+// HTML highlights code as the given language. Unknown languages, including
+// the empty ID, are rendered as plain text with line numbers. Code larger
+// than MaxBytes is rendered as plain text without them.
+func HTML(code, language string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := format(&buf, formatter, code, language)
+	if err != nil {
+		return "", err
+	}
+
+	// The formatter escapes every token, so its output is safe to include
+	// in a page as it is.
+	return template.HTML(buf.String()), nil
+}
+
+// CodeBlock writes code highlighted as the given language, without line
+// numbers. Unlike HTML it accepts any name the highlighter knows, such as
+// "sh" or "py", because it is used for the info strings of fenced code.
+func CodeBlock(w io.Writer, code, language string) error {
+	return format(w, blockFormatter, code, language)
+}
+
+func format(w io.Writer, f *html.Formatter, code, language string) error {
+	if len(code) > MaxBytes {
+		_, err := io.WriteString(w, `<pre class="chroma">`+template.HTMLEscapeString(code)+`</pre>`)
+		return err
+	}
+
+	lexer := lexers.Get(language)
+	if language == "" || language == PlainText || lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return err
+	}
+
+	// The style only matters for inline styles, which are disabled, so
+	// any style will do here.
+	return f.Format(w, styles.Fallback, iterator)
+}
+
+// CSS writes the stylesheet for a theme. It returns false without writing
+// anything if the theme is unknown.
+func CSS(w io.Writer, theme string) (bool, error) {
+	if !IsTheme(theme) {
+		return false, nil
+	}
+
+	return true, formatter.WriteCSS(w, styles.Get(theme))
+}
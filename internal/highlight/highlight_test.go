@@ -0,0 +1,40 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	line := "func main() { fmt.Println(\"<script>alert(1)</script>\") }\n"
+	large := strings.Repeat(line, MaxBytes/len(line)+1)
+
+	tests := []struct {
+		name          string
+		code          string
+		wantHighlight bool
+	}{
+		{"Small", line, true},
+		{"At the limit", large[:MaxBytes], true},
+		{"Too large", large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := HTML(tt.code, "go")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(html), "<script>") {
+				t.Error("got the code unescaped")
+			}
+			if !strings.Contains(string(html), "&lt;script&gt;") {
+				t.Error("got no escaped code")
+			}
+			if got := strings.Contains(string(html), `class="lntable"`); got != tt.wantHighlight {
+				t.Errorf("got highlighted %t; want %t", got, tt.wantHighlight)
+			}
+		})
+	}
+}
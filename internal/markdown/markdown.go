@@ -0,0 +1,118 @@
+// Package markdown renders Markdown snippets to HTML that is safe to include
+// in a page.
+//
+// Source is parsed as CommonMark with the GitHub Flavored Markdown extensions
+// (tables, task lists, strikethrough and autolinks). Fenced code blocks are
+// syntax highlighted, unless the source is larger than highlight.MaxBytes, in
+// which case they are left plain so that rendering stays quick. Raw HTML in the source is dropped by the parser, and the
+// output then passes through an allow-list sanitizer as a second line of
+// defence, so nothing a snippet author writes can inject script or styles.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/fayazp088/snippet-box/internal/highlight"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// The GFM extensions are listed one by one so that table cell alignment can
+// be written as align attributes rather than inline styles, which the
+// Content-Security-Policy would block.
+var extensions = goldmark.WithExtensions(
+	extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	extension.Strikethrough,
+	extension.Linkify,
+	extension.TaskList,
+)
+
+var md = goldmark.New(
+	extensions,
+	goldmark.WithRendererOptions(
+		renderer.WithNodeRenderers(util.Prioritized(codeBlockRenderer{}, 100)),
+	),
+)
+
+// plainMD renders sources too large to highlight.
+var plainMD = goldmark.New(extensions)
+
+// highlightClassRX matches the class names the highlighter puts on code.
+// They are all short lowercase names, so the sanitizer can allow them without
+// letting authors reuse the site's own classes.
+var highlightClassRX = regexp.MustCompile(`^(?:chroma|line|cl|[a-z]{1,2}[0-9]?)$`)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	p.AllowAttrs("class").Matching(highlightClassRX).OnElements("pre", "code", "span")
+
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(?:left|center|right)$`)).OnElements("th", "td")
+
+	// Task list items.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	p.RequireNoReferrerOnLinks(true)
+
+	return p
+}
+
+// Render converts Markdown source to sanitized HTML.
+func Render(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	converter := md
+	if len(source) > highlight.MaxBytes {
+		converter = plainMD
+	}
+
+	err := converter.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// codeBlockRenderer renders fenced code blocks with syntax highlighting.
+type codeBlockRenderer struct{}
+
+func (r codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
+}
+
+func (r codeBlockRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var code bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	var language string
+	if n.Info != nil {
+		language = string(n.Language(source))
+	}
+
+	err := highlight.CodeBlock(w, code.String(), language)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	return ast.WalkSkipChildren, nil
+}
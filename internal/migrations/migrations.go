@@ -0,0 +1,559 @@
+// Package migrations embeds the database schema as an ordered list of
+// migrations and applies them, recording progress in a schema_migrations
+// table.
+//
+// Each dialect has its own directory of files named
+// NNNN_description.up.sql and NNNN_description.down.sql. Versions must be
+// kept in step across dialects so that a given version means the same schema
+// whichever database is in use.
+//
+// Databases created before migrations existed, from the loose SQL files that
+// used to live under internal/sql, are adopted by the first Up: the first
+// migrations are recorded as applied for whichever of their tables are found,
+// after adding any columns those tables gained after the files were first
+// written.
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql
+var files embed.FS
+
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it has been applied. Applied is
+// the zero time for pending migrations.
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// baselineTables names the table created by each migration that replaced
+// the loose SQL files. Databases created from those files already have some
+// or all of these tables, but no record of the migrations.
+var baselineTables = map[int]string{
+	1: "users",
+	2: "sessions",
+	3: "snippets",
+	4: "snippet_revisions",
+	5: "api_tokens",
+}
+
+// Legacy snippets were saved before snippets had authors. When their table
+// is adopted, they are given to a placeholder user that nobody can log in as.
+const (
+	legacyOwnerName  = "legacy"
+	legacyOwnerEmail = "legacy@snippetbox.invalid"
+)
+
+// lockName and lockTimeout identify and bound the wait for the MySQL lock
+// that keeps migrators from running at once.
+const (
+	lockName    = "snippetbox_schema_migrations"
+	lockTimeout = 5 * time.Minute
+)
+
+// errAlreadyDone is returned by run when another migrator applied or
+// reverted the migration first.
+var errAlreadyDone = errors.New("migrations: already done")
+
+// New returns a Migrator for the given dialect ("mysql" or "sqlite").
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: unknown dialect %q", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		matches := fileRX.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("migrations: badly named file %s/%s", dialect, entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+
+		body, err := fs.ReadFile(files, path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migrations: version %d has two names: %s and %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d has no up migration", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied DATETIME NOT NULL
+	)`
+
+	_, err := m.DB.Exec(stmt)
+
+	return err
+}
+
+// applied returns the time each applied migration version was run.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+
+		applied[version] = at
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Status lists every known migration in version order.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		statuses = append(statuses, Status{Migration: mig, Applied: applied[mig.Version]})
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies every pending migration in order and returns those it ran. It
+// stops at the first failure. If no migrations have been recorded, the
+// database is adopted first; see baseline.
+func (m *Migrator) Up() ([]Migration, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err = m.baseline(); err != nil {
+		return nil, err
+	}
+
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range pending {
+		err = m.run(mig, true)
+		if errors.Is(err, errAlreadyDone) {
+			continue
+		}
+		if err != nil {
+			return done, fmt.Errorf("migrations: applying %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Down reverts the most recently applied migrations, at most steps of them,
+// and returns those it reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+
+		if mig.Down == "" {
+			return done, fmt.Errorf("migrations: %04d_%s cannot be reverted", mig.Version, mig.Name)
+		}
+
+		err = m.run(mig, false)
+		if errors.Is(err, errAlreadyDone) {
+			continue
+		}
+		if err != nil {
+			return done, fmt.Errorf("migrations: reverting %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// baseline adopts a database created before migrations existed. If no
+// migrations have been recorded, each migration in baselineTables whose
+// table already exists is recorded as applied without being run, so that Up
+// goes on to create only what is missing. Tables created from the first
+// versions of the SQL files lack columns that those migrations define, so
+// these are added first; see addLegacyColumns.
+func (m *Migrator) baseline() error {
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var recorded int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&recorded); err != nil || recorded > 0 {
+		return err
+	}
+
+	stmt := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if m.dialect == "mysql" {
+		stmt = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`
+	}
+
+	found := make(map[string]bool)
+	for _, table := range baselineTables {
+		var exists int
+		if err = tx.QueryRow(stmt, table).Scan(&exists); err != nil {
+			return err
+		}
+		found[table] = exists > 0
+	}
+
+	if err = m.addLegacyColumns(tx, found); err != nil {
+		return err
+	}
+
+	for _, mig := range m.migrations {
+		table, ok := baselineTables[mig.Version]
+		if !ok || !found[table] {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`,
+			mig.Version, mig.Name, time.Now().UTC().Truncate(time.Second))
+		if err != nil {
+			return fmt.Errorf("migrations: recording existing table %s: %w", table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addLegacyColumns adds the columns that the original users and snippets
+// tables lacked: users.is_admin, and snippets.user_id, which is set to a
+// placeholder user if there are snippets to own. On MySQL, DDL commits
+// implicitly, so a failure part way through may need fixing by hand.
+func (m *Migrator) addLegacyColumns(tx *sql.Tx, found map[string]bool) error {
+	if found["users"] {
+		ok, err := m.hasColumn(tx, "users", "is_admin")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if _, err = tx.Exec(`ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE`); err != nil {
+				return fmt.Errorf("migrations: adding users.is_admin: %w", err)
+			}
+		}
+	}
+
+	if !found["snippets"] {
+		return nil
+	}
+
+	ok, err := m.hasColumn(tx, "snippets", "user_id")
+	if err != nil || ok {
+		return err
+	}
+	if !found["users"] {
+		return errors.New("migrations: the snippets table has no user_id column, and there is no users table to give its snippets an owner")
+	}
+
+	var owner int
+
+	var snippets int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM snippets`).Scan(&snippets); err != nil {
+		return err
+	}
+	if snippets > 0 {
+		if owner, err = insertLegacyOwner(tx); err != nil {
+			return fmt.Errorf("migrations: adding an owner for existing snippets: %w", err)
+		}
+	}
+
+	// SQLite can't add a column with both a foreign key and a default, so
+	// there the column goes without the foreign key.
+	if _, err = tx.Exec(`ALTER TABLE snippets ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return fmt.Errorf("migrations: adding snippets.user_id: %w", err)
+	}
+	if _, err = tx.Exec(`UPDATE snippets SET user_id = ?`, owner); err != nil {
+		return err
+	}
+
+	stmts := []string{`CREATE INDEX idx_snippets_user_id ON snippets(user_id)`}
+	if m.dialect == "mysql" {
+		stmts = append(stmts,
+			`ALTER TABLE snippets ALTER COLUMN user_id DROP DEFAULT`,
+			`ALTER TABLE snippets ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE`)
+	}
+
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrations: adding snippets.user_id: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// hasColumn reports whether table has the named column.
+func (m *Migrator) hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	stmt := `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	if m.dialect == "mysql" {
+		stmt = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	}
+
+	var n int
+	err := tx.QueryRow(stmt, table, column).Scan(&n)
+
+	return n > 0, err
+}
+
+// insertLegacyOwner adds the placeholder user that owns legacy snippets and
+// returns its ID. Its password is random and thrown away.
+func insertLegacyOwner(tx *sql.Tx) (int, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(base64.StdEncoding.EncodeToString(password)), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, ?)`,
+		legacyOwnerName, legacyOwnerEmail, string(hashedPassword), time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+
+	return int(id), err
+}
+
+// lock keeps other migrators, such as several servers started with
+// -auto-migrate at once, from migrating the database at the same time, and
+// returns a function that releases it. On MySQL it takes a named lock, which
+// belongs to a connection, so one connection is held until it is released.
+// SQLite needs no lock of its own: run checks inside each transaction that
+// the migration is still to be done, and with _txlock=immediate, as in the
+// default DSN, those transactions take the write lock before that check.
+func (m *Migrator) lock() (func(), error) {
+	if m.dialect != "mysql" {
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, int(lockTimeout.Seconds())).Scan(&locked)
+	if err == nil && locked.Int64 != 1 {
+		err = fmt.Errorf("migrations: timed out after %s waiting for another migrator to finish", lockTimeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, lockName)
+		conn.Close()
+	}, nil
+}
+
+// run applies or reverts a migration, executing its statements followed by
+// the bookkeeping statement inside one transaction. It returns
+// errAlreadyDone, having changed nothing, if another migrator got there
+// first. MySQL commits DDL implicitly, so there a failed migration may be
+// left partially applied and need fixing by hand.
+func (m *Migrator) run(mig Migration, up bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var recorded int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, mig.Version).Scan(&recorded)
+	if err != nil {
+		return err
+	}
+	if up == (recorded > 0) {
+		return errAlreadyDone
+	}
+
+	script := mig.Up
+	record := `INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)`
+	args := []any{mig.Version, mig.Name, time.Now().UTC().Truncate(time.Second)}
+
+	if !up {
+		script = mig.Down
+		record = `DELETE FROM schema_migrations WHERE version = ?`
+		args = []any{mig.Version}
+	}
+
+	for _, stmt := range statements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// statements splits a migration script into individual statements, dropping
+// comment lines. Statements end with a semicolon at the end of a line.
+func statements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";\n") {
+		stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	return stmts
+}
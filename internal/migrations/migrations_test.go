@@ -0,0 +1,307 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// legacySchema is the schema of the SQL files under internal/sql as they
+// first shipped, before migrations existed, in SQLite's dialect: users have
+// no is_admin column, and snippets no user_id.
+const legacySchema = `CREATE TABLE users (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+name VARCHAR(255) NOT NULL,
+email VARCHAR(255) NOT NULL,
+hashed_password CHAR(60) NOT NULL,
+created DATETIME NOT NULL,
+CONSTRAINT users_uc_email UNIQUE (email)
+);
+
+CREATE TABLE snippets (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+title VARCHAR(100) NOT NULL,
+content TEXT NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+
+CREATE TABLE sessions (
+token CHAR(43) PRIMARY KEY,
+data BLOB NOT NULL,
+expiry REAL NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);`
+
+// legacyVersions are the migrations whose tables legacySchema has.
+var legacyVersions = map[int]bool{1: true, 2: true, 3: true}
+
+// createLegacy applies legacySchema to db.
+func createLegacy(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	for _, stmt := range statements(legacySchema) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// openDB opens a new SQLite database file with the options of the default
+// DSN. Each call with the same path gets its own pool of connections, as a
+// separate server process would.
+func openDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func newMigrator(t *testing.T, db *sql.DB) *Migrator {
+	t.Helper()
+
+	m, err := New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func pendingCount(t *testing.T, m *Migrator) int {
+	t.Helper()
+
+	pending, err := m.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(pending)
+}
+
+func TestUpAndDown(t *testing.T) {
+	m := newMigrator(t, openDB(t, filepath.Join(t.TempDir(), "test.db")))
+	total := len(m.migrations)
+
+	done, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != total || pendingCount(t, m) != 0 {
+		t.Fatalf("got %d applied and %d pending; want %d and 0", len(done), pendingCount(t, m), total)
+	}
+
+	done, err = m.Up()
+	if err != nil || len(done) != 0 {
+		t.Fatalf("second Up: got %d applied, err %v; want none", len(done), err)
+	}
+
+	done, err = m.Down(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done[0].Version != total || done[1].Version != total-1 {
+		t.Fatalf("got %v reverted; want the last two migrations, newest first", done)
+	}
+
+	done, err = m.Up()
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Up after Down: got %d applied, err %v; want 2", len(done), err)
+	}
+}
+
+func TestUpBaseline(t *testing.T) {
+	tests := []struct {
+		name      string
+		snippets  int
+		wantOwner bool
+	}{
+		{"With snippets", 2, true},
+		{"Without snippets", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t, filepath.Join(t.TempDir(), "test.db"))
+			createLegacy(t, db)
+
+			_, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES ('Alice', 'alice@example.com', 'x', CURRENT_TIMESTAMP)`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.snippets; i++ {
+				_, err = db.Exec(`INSERT INTO snippets (title, content, created, expires) VALUES ('Old', 'Old', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m := newMigrator(t, db)
+
+			done, err := m.Up()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The legacy tables are adopted, and everything after them is run.
+			ran := map[int]bool{}
+			for _, mig := range done {
+				ran[mig.Version] = true
+			}
+			for _, mig := range m.migrations {
+				if ran[mig.Version] == legacyVersions[mig.Version] {
+					t.Errorf("version %d: got run %t; want %t", mig.Version, ran[mig.Version], !legacyVersions[mig.Version])
+				}
+			}
+
+			if n := pendingCount(t, m); n != 0 {
+				t.Errorf("got %d pending migrations; want 0", n)
+			}
+
+			var isAdmin bool
+			if err = db.QueryRow(`SELECT is_admin FROM users WHERE email = 'alice@example.com'`).Scan(&isAdmin); err != nil {
+				t.Fatalf("existing user: %v", err)
+			}
+			if isAdmin {
+				t.Error("got existing user made an admin")
+			}
+
+			// Every snippet has an author that the models can join on.
+			var owned int
+			var owner string
+			err = db.QueryRow(`SELECT COUNT(*), COALESCE(MAX(u.name), '') FROM snippets s INNER JOIN users u ON u.id = s.user_id`).Scan(&owned, &owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owned != tt.snippets || (tt.snippets > 0 && owner != legacyOwnerName) {
+				t.Errorf("got %d snippets owned by %q; want %d owned by %q", owned, owner, tt.snippets, legacyOwnerName)
+			}
+
+			var users int
+			if err = db.QueryRow(`SELECT COUNT(*) FROM users WHERE email = ?`, legacyOwnerEmail).Scan(&users); err != nil {
+				t.Fatal(err)
+			}
+			if (users == 1) != tt.wantOwner {
+				t.Errorf("got %d placeholder owners; want one %t", users, tt.wantOwner)
+			}
+		})
+	}
+}
+
+func TestUpConcurrent(t *testing.T) {
+	tests := []struct {
+		name   string
+		legacy bool
+	}{
+		{name: "New database"},
+		{name: "Legacy database", legacy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.db")
+
+			if tt.legacy {
+				createLegacy(t, openDB(t, path))
+			}
+
+			const migrators = 4
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				applied = map[int]int{}
+				errs    []error
+			)
+
+			for i := 0; i < migrators; i++ {
+				m := newMigrator(t, openDB(t, path))
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					done, err := m.Up()
+
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						errs = append(errs, err)
+					}
+					for _, mig := range done {
+						applied[mig.Version]++
+					}
+				}()
+			}
+
+			wg.Wait()
+
+			for _, err := range errs {
+				t.Error(err)
+			}
+
+			m := newMigrator(t, openDB(t, path))
+			for _, mig := range m.migrations {
+				want := 1
+				if tt.legacy && legacyVersions[mig.Version] {
+					want = 0
+				}
+				if applied[mig.Version] != want {
+					t.Errorf("version %d applied %d times; want %d", mig.Version, applied[mig.Version], want)
+				}
+			}
+			if n := pendingCount(t, m); n != 0 {
+				t.Errorf("got %d pending migrations; want 0", n)
+			}
+		})
+	}
+}
+
+func TestStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "One statement",
+			script: "CREATE TABLE a (id INTEGER);\n",
+			want:   []string{"CREATE TABLE a (id INTEGER)"},
+		},
+		{
+			name:   "Comments and blank lines",
+			script: "-- a comment\nCREATE TABLE a (id INTEGER);\n\n  -- another\nDROP TABLE b;",
+			want:   []string{"CREATE TABLE a (id INTEGER)", "DROP TABLE b"},
+		},
+		{
+			name:   "Semicolon inside a line",
+			script: "INSERT INTO a VALUES (';');\n",
+			want:   []string{"INSERT INTO a VALUES (';')"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := statements(tt.script)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q; want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q; want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,10 @@
-
 CREATE TABLE users (
 id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, 
 name VARCHAR(255) NOT NULL,
 email VARCHAR(255) NOT NULL,
 hashed_password CHAR(60) NOT NULL,
-created DATETIME NOT NULL
+created DATETIME NOT NULL,
+is_admin BOOLEAN NOT NULL DEFAULT FALSE
 );
 
-ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
\ No newline at end of file
+ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
@@ -0,0 +1,12 @@
+CREATE TABLE snippets (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, title VARCHAR(100) NOT NULL,
+content TEXT NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+user_id INTEGER NOT NULL
+);
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,13 @@
+CREATE TABLE snippet_revisions (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+snippet_id INTEGER NOT NULL,
+revision INTEGER NOT NULL,
+title VARCHAR(100) NOT NULL,
+content TEXT NOT NULL,
+created DATETIME NOT NULL,
+user_id INTEGER NOT NULL
+);
+
+ALTER TABLE snippet_revisions ADD CONSTRAINT snippet_revisions_uc_revision UNIQUE (snippet_id, revision);
+ALTER TABLE snippet_revisions ADD CONSTRAINT fk_snippet_revisions_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE;
+ALTER TABLE snippet_revisions ADD CONSTRAINT fk_snippet_revisions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,12 @@
+CREATE TABLE api_tokens (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+hash CHAR(64) NOT NULL,
+scope VARCHAR(10) NOT NULL,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_uc_hash UNIQUE (hash);
+ALTER TABLE api_tokens ADD CONSTRAINT fk_api_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
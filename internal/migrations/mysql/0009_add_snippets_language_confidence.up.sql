@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN language_confidence DOUBLE NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE snippets ADD COLUMN updated DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE snippets SET updated = created;
@@ -0,0 +1,4 @@
+ALTER TABLE snippets DROP INDEX snippets_uc_slug;
+
+ALTER TABLE snippets DROP COLUMN slug;
+ALTER TABLE snippets DROP COLUMN visibility;
@@ -0,0 +1,4 @@
+ALTER TABLE snippet_revisions MODIFY content TEXT NOT NULL;
+ALTER TABLE snippets MODIFY content TEXT NOT NULL;
+
+ALTER TABLE snippets DROP COLUMN content_key;
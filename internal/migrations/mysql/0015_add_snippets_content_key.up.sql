@@ -0,0 +1,5 @@
+ALTER TABLE snippets ADD COLUMN content_key VARCHAR(255) NULL;
+
+-- Encrypted content is base64 encoded, a third longer than the text itself.
+ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL;
+ALTER TABLE snippet_revisions MODIFY content MEDIUMTEXT NOT NULL;
@@ -0,0 +1,9 @@
+CREATE TABLE users (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+name VARCHAR(255) NOT NULL,
+email VARCHAR(255) NOT NULL,
+hashed_password CHAR(60) NOT NULL,
+created DATETIME NOT NULL,
+is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+CONSTRAINT users_uc_email UNIQUE (email)
+);
@@ -0,0 +1,9 @@
+-- SQLite deployments keep sessions in memory, but the table is created anyway
+-- so that migration versions stay in step with the MySQL schema.
+CREATE TABLE sessions (
+token CHAR(43) PRIMARY KEY,
+data BLOB NOT NULL,
+expiry REAL NOT NULL
+);
+
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
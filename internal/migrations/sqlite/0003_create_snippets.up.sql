@@ -0,0 +1,11 @@
+CREATE TABLE snippets (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+title VARCHAR(100) NOT NULL,
+content TEXT NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
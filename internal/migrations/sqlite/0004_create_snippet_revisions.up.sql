@@ -0,0 +1,10 @@
+CREATE TABLE snippet_revisions (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+revision INTEGER NOT NULL,
+title VARCHAR(100) NOT NULL,
+content TEXT NOT NULL,
+created DATETIME NOT NULL,
+user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+CONSTRAINT snippet_revisions_uc_revision UNIQUE (snippet_id, revision)
+);
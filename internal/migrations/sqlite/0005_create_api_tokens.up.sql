@@ -0,0 +1,10 @@
+CREATE TABLE api_tokens (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+name VARCHAR(100) NOT NULL,
+hash CHAR(64) NOT NULL,
+scope VARCHAR(10) NOT NULL,
+created DATETIME NOT NULL,
+last_used DATETIME NULL,
+CONSTRAINT api_tokens_uc_hash UNIQUE (hash)
+);
@@ -0,0 +1 @@
+-- Nothing to revert: the up migration makes no changes on SQLite.
@@ -0,0 +1,2 @@
+-- SQLite has no FULLTEXT indexes. Searches against a SQLite database are
+-- answered by the in-process index in internal/search instead.
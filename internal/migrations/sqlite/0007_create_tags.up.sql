@@ -0,0 +1,13 @@
+CREATE TABLE tags (
+id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+name VARCHAR(30) NOT NULL,
+CONSTRAINT tags_uc_name UNIQUE (name)
+);
+
+CREATE TABLE snippet_tags (
+snippet_id INTEGER NOT NULL REFERENCES snippets(id) ON DELETE CASCADE,
+tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+PRIMARY KEY (snippet_id, tag_id)
+);
+
+CREATE INDEX idx_snippet_tags_tag_id ON snippet_tags(tag_id);
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN language_confidence REAL NOT NULL DEFAULT 0;
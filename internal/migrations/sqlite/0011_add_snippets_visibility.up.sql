@@ -0,0 +1,4 @@
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(32);
+
+CREATE UNIQUE INDEX snippets_uc_slug ON snippets(slug);
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN content_key VARCHAR(255);
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// nullTime scans a nullable DATETIME column into a time.Time, leaving it zero
+// for NULL.
+type nullTime struct {
+	t *time.Time
+}
+
+func (n nullTime) Scan(value any) error {
+	var nt sql.NullTime
+
+	if err := nt.Scan(value); err != nil {
+		return err
+	}
+
+	*n.t = nt.Time
+
+	return nil
+}
+
+// Burn reads a burn-after-reading snippet for the last time. It returns the
+// snippet as it was, without its tags, and in the same transaction deletes
+// everything about it except that it was read and when: its title, content,
+// passphrase, revisions and tags are gone once Burn returns. Only one caller
+// can burn a snippet; everyone else, even at the same moment, gets
+// ErrNoRecord, as they do for snippets that are not burn-after-reading.
+func (m *SnippetModel) Burn(id int) (Snippet, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return Snippet{}, err
+	}
+	defer tx.Rollback()
+
+	now := Now()
+
+	// Claim the snippet before reading it. The update takes the row lock (or
+	// SQLite's write lock) first, so concurrent readers wait their turn and
+	// then find the snippet burned. Reading first would leave SQLite
+	// transactions without _txlock=immediate holding a read lock they can't
+	// upgrade, which fails with SQLITE_BUSY instead of waiting.
+	stmt := `UPDATE snippets SET burned = ?
+	WHERE id = ? AND expires > ? AND burn_after_reading = ? AND burned IS NULL`
+
+	result, err := tx.Exec(stmt, now, id, now, true)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	if rows == 0 {
+		return Snippet{}, ErrNoRecord
+	}
+
+	query := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.id = ?`
+
+	var snippet Snippet
+
+	err = tx.QueryRow(query, id).Scan(snippet.dest()...)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	// Decrypt the content before burning it, so that it isn't lost unread
+	// if the master key is missing.
+	if err = m.open(&snippet); err != nil {
+		return Snippet{}, err
+	}
+
+	for _, stmt := range []string{
+		`UPDATE snippets SET title = '', content = '', language = '', hashed_passphrase = NULL, content_key = NULL
+		WHERE id = ?`,
+		`DELETE FROM snippet_revisions WHERE snippet_id = ?`,
+		`DELETE FROM snippet_tags WHERE snippet_id = ?`,
+	} {
+		if _, err = tx.Exec(stmt, id); err != nil {
+			return Snippet{}, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return Snippet{}, err
+	}
+
+	return snippet, nil
+}
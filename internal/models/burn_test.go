@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelBurn(t *testing.T) {
+	db := newTestDB(t)
+	deferred := openDeferred(t, db)
+
+	userID := newTestUser(t, db, "alice")
+
+	tests := []struct {
+		name string
+		db   *sql.DB
+	}{
+		{"Immediate transactions", db},
+		{"Deferred transactions", deferred},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &SnippetModel{DB: tt.db}
+
+			id, err := m.Insert(userID, SnippetInput{
+				Title:            "Secret",
+				Content:          "Secret",
+				Visibility:       VisibilityUnlisted,
+				Expires:          7,
+				BurnAfterReading: true,
+				Tags:             []string{"once"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			const readers = 16
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				burned  []Snippet
+				missing int
+				errs    []error
+				start   = make(chan struct{})
+			)
+
+			for i := 0; i < readers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					<-start
+					snippet, err := m.Burn(id)
+
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						burned = append(burned, snippet)
+					case errors.Is(err, ErrNoRecord):
+						missing++
+					default:
+						errs = append(errs, err)
+					}
+				}()
+			}
+
+			close(start)
+			wg.Wait()
+
+			for _, err := range errs {
+				t.Error(err)
+			}
+			if len(burned) != 1 || missing != readers-1 {
+				t.Fatalf("got %d readers shown the snippet and %d told it was gone; want 1 and %d", len(burned), missing, readers-1)
+			}
+			if burned[0].Content != "Secret" || burned[0].Burned.IsZero() {
+				t.Errorf("got content %q, burned at %v; want the content and when it was burned", burned[0].Content, burned[0].Burned)
+			}
+
+			after, err := m.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Title != "" || after.Content != "" || len(after.Tags) != 0 || after.Burned.IsZero() {
+				t.Errorf("got title %q, content %q and tags %q left after burning; want only when it was burned", after.Title, after.Content, after.Tags)
+			}
+
+			var revisions int
+			if err = tt.db.QueryRow(`SELECT COUNT(*) FROM snippet_revisions WHERE snippet_id = ?`, id).Scan(&revisions); err != nil {
+				t.Fatal(err)
+			}
+			if revisions != 0 {
+				t.Errorf("got %d revisions left after burning; want 0", revisions)
+			}
+		})
+	}
+
+	t.Run("Busy database", func(t *testing.T) {
+		m := &SnippetModel{DB: deferred}
+
+		id, err := m.Insert(userID, SnippetInput{Title: "Secret", Content: "Secret", Visibility: VisibilityUnlisted, Expires: 7, BurnAfterReading: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Another writer holds the write lock, as a concurrent Burn would.
+		// Burn must wait for it to commit rather than fail.
+		writer, err := deferred.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer writer.Rollback()
+
+		if _, err = writer.Exec(`UPDATE users SET name = name WHERE id = ?`, userID); err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error)
+		go func() {
+			_, err := m.Burn(id)
+			done <- err
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+
+		if err = writer.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = <-done; err != nil {
+			t.Errorf("got error %v; want Burn to wait for the lock", err)
+		}
+	})
+
+	t.Run("Not burn after reading", func(t *testing.T) {
+		m := &SnippetModel{DB: db}
+
+		id, err := m.Insert(userID, SnippetInput{Title: "Kept", Content: "Kept", Visibility: VisibilityUnlisted, Expires: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = m.Burn(id); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v; want ErrNoRecord", err)
+		}
+	})
+}
@@ -0,0 +1,337 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/fayazp088/snippet-box/internal/envelope"
+)
+
+// Snippet content is encrypted at rest with envelope encryption. Each snippet
+// has a data key of its own, stored wrapped by a master key in
+// snippets.content_key, which encrypts both its content and the content of its
+// revisions. A NULL content_key means the snippet and its revisions are stored
+// in clear text, as they were before a master key was loaded; EncryptAll
+// encrypts them. RewrapKeys rotates master keys by wrapping the data keys
+// again, leaving the content alone.
+
+// newContentKey returns a new data key for a snippet, along with the wrapped
+// key to store in content_key. Without master keys, the key is nil and the
+// wrapped key NULL, and content is stored in clear text.
+func (m *SnippetModel) newContentKey() (*envelope.DataKey, any, error) {
+	if m.Keys == nil {
+		return nil, nil, nil
+	}
+
+	key, wrapped, err := m.Keys.NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &key, wrapped, nil
+}
+
+// unwrapContentKey returns the data key that content_key holds, or nil if it
+// is empty because the content is stored in clear text.
+func unwrapContentKey(keys *envelope.Keyring, contentKey string) (*envelope.DataKey, error) {
+	if contentKey == "" {
+		return nil, nil
+	}
+	if keys == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	key, err := keys.Unwrap(contentKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// readable returns a condition on snippets s that leaves out those whose data
+// key was wrapped by a master key that isn't loaded, and so can't be
+// decrypted.
+func (m *SnippetModel) readable() (string, []any) {
+	conditions := []string{"s.content_key IS NULL"}
+	var args []any
+
+	if m.Keys != nil {
+		for _, id := range m.Keys.IDs() {
+			conditions = append(conditions, fmt.Sprintf("SUBSTR(s.content_key, 1, %d) = ?", len(id)+1))
+			args = append(args, id+":")
+		}
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// sealContent encrypts content with key, if there is one.
+func sealContent(key *envelope.DataKey, content string) (string, error) {
+	if key == nil {
+		return content, nil
+	}
+	return key.Seal(content)
+}
+
+// openContent decrypts content sealed with key, if there is one.
+func openContent(key *envelope.DataKey, content string) (string, error) {
+	if key == nil {
+		return content, nil
+	}
+	return key.Open(content)
+}
+
+// open decrypts the content of a snippet loaded from the database.
+func (m *SnippetModel) open(s *Snippet) error {
+	key, err := unwrapContentKey(m.Keys, s.contentKey)
+	if err != nil {
+		return err
+	}
+
+	s.Content, err = openContent(key, s.Content)
+
+	return err
+}
+
+// encryptionBatchSize is the number of snippets read at a time by RewrapKeys
+// and EncryptAll.
+const encryptionBatchSize = 100
+
+// snippetKeys returns the IDs and content keys of up to encryptionBatchSize
+// snippets with IDs above afterID, in ID order. If encrypted is true, only
+// snippets with a data key are returned; otherwise only those without, less
+// burned snippets, which have no content left to encrypt.
+func (m *SnippetModel) snippetKeys(afterID int, encrypted bool) ([]int, []string, error) {
+	query := `SELECT id, COALESCE(content_key, '') FROM snippets
+	WHERE id > ? AND content_key IS NOT NULL ORDER BY id LIMIT ?`
+	if !encrypted {
+		query = `SELECT id, COALESCE(content_key, '') FROM snippets
+	WHERE id > ? AND content_key IS NULL AND burned IS NULL ORDER BY id LIMIT ?`
+	}
+
+	rows, err := m.DB.Query(query, afterID, encryptionBatchSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	var keys []string
+
+	for rows.Next() {
+		var id int
+		var key string
+
+		if err = rows.Scan(&id, &key); err != nil {
+			return nil, nil, err
+		}
+
+		ids = append(ids, id)
+		keys = append(keys, key)
+	}
+
+	return ids, keys, rows.Err()
+}
+
+// RewrapKeys wraps the data key of every encrypted snippet with the primary
+// master key, returning the number of keys that were wrapped again. Each key
+// is updated by itself, so the server keeps running throughout, as long as it
+// has both the old and the new master keys loaded.
+func (m *SnippetModel) RewrapKeys() (int, error) {
+	if m.Keys == nil {
+		return 0, ErrNoMasterKey
+	}
+
+	primary := m.Keys.Primary()
+	rewrapped := 0
+
+	for afterID := 0; ; {
+		ids, keys, err := m.snippetKeys(afterID, true)
+		if err != nil {
+			return rewrapped, err
+		}
+		if len(ids) == 0 {
+			return rewrapped, nil
+		}
+
+		for i, id := range ids {
+			if envelope.WrappedBy(keys[i]) == primary {
+				continue
+			}
+
+			key, err := m.Keys.Rewrap(keys[i])
+			if err != nil {
+				return rewrapped, err
+			}
+
+			// The snippet may have been burned or deleted since it was read.
+			result, err := m.DB.Exec(`UPDATE snippets SET content_key = ? WHERE id = ? AND content_key = ?`, key, id, keys[i])
+			if err != nil {
+				return rewrapped, err
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return rewrapped, err
+			}
+			rewrapped += int(n)
+		}
+
+		afterID = ids[len(ids)-1]
+	}
+}
+
+// EncryptAll encrypts the content and revisions of every snippet still stored
+// in clear text, one snippet per transaction, returning the number of
+// snippets encrypted. Burned snippets are skipped.
+func (m *SnippetModel) EncryptAll() (int, error) {
+	if m.Keys == nil {
+		return 0, ErrNoMasterKey
+	}
+
+	encrypted := 0
+
+	for afterID := 0; ; {
+		ids, _, err := m.snippetKeys(afterID, false)
+		if err != nil {
+			return encrypted, err
+		}
+		if len(ids) == 0 {
+			return encrypted, nil
+		}
+
+		for _, id := range ids {
+			ok, err := m.encrypt(id)
+			if err != nil {
+				return encrypted, err
+			}
+			if ok {
+				encrypted++
+			}
+		}
+
+		afterID = ids[len(ids)-1]
+	}
+}
+
+// encrypt gives a snippet stored in clear text a data key and encrypts its
+// content and revisions with it. It reports false if the snippet has been
+// encrypted, burned or deleted in the meantime.
+func (m *SnippetModel) encrypt(id int) (bool, error) {
+	key, contentKey, err := m.newContentKey()
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Setting the key first locks the row, so that an edit can't slip in
+	// between reading the content and writing it back encrypted.
+	result, err := tx.Exec(`UPDATE snippets SET content_key = ? WHERE id = ? AND content_key IS NULL AND burned IS NULL`, contentKey, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	var content string
+
+	err = tx.QueryRow(`SELECT content FROM snippets WHERE id = ?`, id).Scan(&content)
+	if err != nil {
+		return false, err
+	}
+
+	content, err = sealContent(key, content)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = tx.Exec(`UPDATE snippets SET content = ? WHERE id = ?`, content, id); err != nil {
+		return false, err
+	}
+
+	if err = encryptRevisions(tx, id, key); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// encryptRevisions encrypts the content of a snippet's revisions with its
+// data key.
+func encryptRevisions(tx *sql.Tx, snippetID int, key *envelope.DataKey) error {
+	rows, err := tx.Query(`SELECT id, content FROM snippet_revisions WHERE snippet_id = ?`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	contents := make(map[int]string)
+
+	for rows.Next() {
+		var id int
+		var content string
+
+		if err = rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+
+		contents[id] = content
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, content := range contents {
+		content, err = sealContent(key, content)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(`UPDATE snippet_revisions SET content = ? WHERE id = ?`, content, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// KeyUsage counts snippets by the ID of the master key that wraps their data
+// key. Snippets stored in clear text are counted under ""; burned snippets,
+// which have no content left, aren't counted.
+func (m *SnippetModel) KeyUsage() (map[string]int, error) {
+	query := `SELECT COALESCE(SUBSTR(content_key, 1, INSTR(content_key, ':') - 1), ''), COUNT(*)
+	FROM snippets WHERE burned IS NULL GROUP BY 1`
+
+	rows, err := m.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make(map[string]int)
+
+	for rows.Next() {
+		var id string
+		var count int
+
+		if err = rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+
+		usage[id] += count
+	}
+
+	return usage, rows.Err()
+}
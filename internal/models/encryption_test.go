@@ -0,0 +1,436 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/envelope"
+)
+
+// newTestKeys returns new random master keys with the given IDs, in the form
+// envelope.ParseKeys reads.
+func newTestKeys(t *testing.T, ids ...string) []string {
+	t.Helper()
+
+	var keys []string
+	for _, id := range ids {
+		key, err := envelope.GenerateKey(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// newTestKeyring returns a keyring holding the given master keys, the first
+// being the primary.
+func newTestKeyring(t *testing.T, keys ...string) *envelope.Keyring {
+	t.Helper()
+
+	k, err := envelope.ParseKeys(strings.Join(keys, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+// storedContent returns the content and content key of a snippet as they are
+// stored in the database.
+func storedContent(t *testing.T, db *sql.DB, id int) (string, string) {
+	t.Helper()
+
+	var content, contentKey string
+
+	err := db.QueryRow(`SELECT content, COALESCE(content_key, '') FROM snippets WHERE id = ?`, id).Scan(&content, &contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content, contentKey
+}
+
+// checkRevisions fails the test unless the revisions of a snippet, newest
+// first, hold the given content.
+func checkRevisions(t *testing.T, m *RevisionModel, id int, want ...string) {
+	t.Helper()
+
+	revisions, err := m.All(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range revisions {
+		got = append(got, r.Content)
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got revisions %q; want %q", got, want)
+	}
+}
+
+func TestSnippetModelEncryption(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	keys := newTestKeyring(t, newTestKeys(t, "a")...)
+	m := &SnippetModel{DB: db, Keys: keys}
+	revisions := &RevisionModel{DB: db, Keys: keys}
+
+	id, err := m.Insert(userID, SnippetInput{Title: "Hello", Content: "First", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Update(id, userID, SnippetInput{Title: "Hello", Content: "Second", Visibility: VisibilityPublic, Expires: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, contentKey := storedContent(t, db, id)
+	if strings.Contains(content, "Second") || envelope.WrappedBy(contentKey) != "a" {
+		t.Errorf("got content %q stored with key %q; want it encrypted with a key wrapped by a", content, contentKey)
+	}
+
+	snippet, err := m.Get(id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.Content != "Second" {
+		t.Errorf("got content %q; want Second", snippet.Content)
+	}
+	checkRevisions(t, revisions, id, "Second", "First")
+
+	tests := []struct {
+		name    string
+		keys    *envelope.Keyring
+		wantErr error
+	}{
+		{"No master keys", nil, ErrNoMasterKey},
+		{"Unknown key ID", newTestKeyring(t, newTestKeys(t, "b")...), envelope.ErrUnknownKey},
+		{"Wrong key", newTestKeyring(t, newTestKeys(t, "a")...), envelope.ErrDecrypt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &SnippetModel{DB: db, Keys: tt.keys}
+
+			if _, err := m.Get(id, userID); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			if _, err := (&RevisionModel{DB: db, Keys: tt.keys}).All(id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("revisions: got error %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnippetModelEncryptAll(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	// Snippets saved before any master key was loaded.
+	clear := &SnippetModel{DB: db}
+
+	edited, err := clear.Insert(userID, SnippetInput{Title: "Edited", Content: "First", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = clear.Update(edited, userID, SnippetInput{Title: "Edited", Content: "Second", Visibility: VisibilityPublic, Expires: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	burned, err := clear.Insert(userID, SnippetInput{Title: "Burned", Content: "Burned", Visibility: VisibilityUnlisted, Expires: 7, BurnAfterReading: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = clear.Burn(burned); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := newTestKeyring(t, newTestKeys(t, "a")...)
+	m := &SnippetModel{DB: db, Keys: keys}
+
+	// A snippet saved after the key was loaded is already encrypted.
+	encrypted, err := m.Insert(userID, SnippetInput{Title: "New", Content: "New", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, encryptedKey := storedContent(t, db, encrypted)
+
+	if _, err = clear.EncryptAll(); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("got error %v without master keys; want ErrNoMasterKey", err)
+	}
+
+	n, err := m.EncryptAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d snippets encrypted; want 1", n)
+	}
+
+	content, contentKey := storedContent(t, db, edited)
+	if strings.Contains(content, "Second") || envelope.WrappedBy(contentKey) != "a" {
+		t.Errorf("got content %q stored with key %q; want it encrypted", content, contentKey)
+	}
+
+	var stored string
+	if err = db.QueryRow(`SELECT content FROM snippet_revisions WHERE snippet_id = ? AND revision = 1`, edited).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored == "First" {
+		t.Error("got the first revision still stored in clear text")
+	}
+
+	snippet, err := m.Get(edited, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.Content != "Second" {
+		t.Errorf("got content %q; want Second", snippet.Content)
+	}
+	checkRevisions(t, &RevisionModel{DB: db, Keys: keys}, edited, "Second", "First")
+
+	if _, contentKey = storedContent(t, db, burned); contentKey != "" {
+		t.Errorf("got burned snippet given key %q; want it left alone", contentKey)
+	}
+	if _, contentKey = storedContent(t, db, encrypted); contentKey != encryptedKey {
+		t.Error("got an encrypted snippet's key changed")
+	}
+
+	usage, err := m.KeyUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage["a"] != 2 {
+		t.Errorf("got key usage %v; want both live snippets under a", usage)
+	}
+
+	if n, err = m.EncryptAll(); err != nil || n != 0 {
+		t.Errorf("got %d snippets encrypted again, error %v; want none", n, err)
+	}
+}
+
+func TestSnippetModelRewrapKeys(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	keys := newTestKeys(t, "old", "new")
+
+	old := &SnippetModel{DB: db, Keys: newTestKeyring(t, keys[0])}
+
+	var ids []int
+	for i := 0; i < encryptionBatchSize+5; i++ {
+		id, err := old.Insert(userID, SnippetInput{Title: "Hello", Content: fmt.Sprint("Content ", i), Visibility: VisibilityPublic, Expires: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	clear := &SnippetModel{DB: db}
+
+	plain, err := clear.Insert(userID, SnippetInput{Title: "Clear", Content: "Clear", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key becomes the primary, with the old one kept to unwrap with.
+	m := &SnippetModel{DB: db, Keys: newTestKeyring(t, keys[1], keys[0])}
+
+	if _, err = clear.RewrapKeys(); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("got error %v without master keys; want ErrNoMasterKey", err)
+	}
+
+	n, err := m.RewrapKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(ids) {
+		t.Errorf("got %d keys wrapped again; want %d", n, len(ids))
+	}
+
+	if n, err = m.RewrapKeys(); err != nil || n != 0 {
+		t.Errorf("got %d keys wrapped again a second time, error %v; want none", n, err)
+	}
+
+	usage, err := m.KeyUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 2 || usage["new"] != len(ids) || usage[""] != 1 {
+		t.Errorf("got key usage %v; want %d under new and 1 in clear text", usage, len(ids))
+	}
+
+	// Once every key is wrapped again, the old master key can be retired.
+	retired := &SnippetModel{DB: db, Keys: newTestKeyring(t, keys[1])}
+	revisions := &RevisionModel{DB: db, Keys: retired.Keys}
+
+	for i, id := range ids {
+		snippet, err := retired.Get(id, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint("Content ", i); snippet.Content != want {
+			t.Errorf("got content %q; want %q", snippet.Content, want)
+		}
+	}
+	checkRevisions(t, revisions, ids[0], "Content 0")
+
+	snippet, err := retired.Get(plain, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.Content != "Clear" {
+		t.Errorf("got content %q for a snippet in clear text; want Clear", snippet.Content)
+	}
+}
+
+func TestSnippetModelUpdateWithoutRevisions(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	keys := newTestKeyring(t, newTestKeys(t, "a")...)
+	m := &SnippetModel{DB: db, Keys: keys}
+
+	id, err := m.Insert(userID, SnippetInput{Title: "Hello", Content: "Hello", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As if the snippet was saved before revisions were recorded.
+	if _, err = db.Exec(`DELETE FROM snippet_revisions WHERE snippet_id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Update(id, userID, SnippetInput{Title: "Hello", Content: "Hello", Visibility: VisibilityPublic, Expires: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRevisions(t, &RevisionModel{DB: db, Keys: keys}, id, "Hello")
+}
+
+func TestSnippetModelUpdateWhileEncrypting(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	keys := newTestKeyring(t, newTestKeys(t, "a")...)
+	revisions := &RevisionModel{DB: db, Keys: keys}
+
+	for _, conn := range []*sql.DB{db, openDeferred(t, db)} {
+		clear := &SnippetModel{DB: conn}
+		m := &SnippetModel{DB: conn, Keys: keys}
+
+		for i := 0; i < 20; i++ {
+			id, err := clear.Insert(userID, SnippetInput{Title: "Hello", Content: "Before", Visibility: VisibilityPublic, Expires: 7})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				wg         sync.WaitGroup
+				updateErr  error
+				encryptErr error
+				start      = make(chan struct{})
+			)
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				updateErr = m.Update(id, userID, SnippetInput{Title: "Hello", Content: "After", Visibility: VisibilityPublic, Expires: 7})
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				_, encryptErr = m.encrypt(id)
+			}()
+
+			close(start)
+			wg.Wait()
+
+			if updateErr != nil || encryptErr != nil {
+				t.Fatalf("got update error %v and encrypt error %v; want neither", updateErr, encryptErr)
+			}
+
+			// Whichever went first, the content is encrypted and readable.
+			content, contentKey := storedContent(t, db, id)
+			if content == "After" || contentKey == "" {
+				t.Fatalf("got content %q stored with key %q; want it encrypted", content, contentKey)
+			}
+
+			snippet, err := m.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippet.Content != "After" {
+				t.Errorf("got content %q; want After", snippet.Content)
+			}
+			checkRevisions(t, revisions, id, "After", "Before")
+		}
+	}
+}
+
+func TestSnippetModelListUndecryptable(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+
+	var logs bytes.Buffer
+	m := &SnippetModel{
+		DB:     db,
+		Keys:   newTestKeyring(t, newTestKeys(t, "a")...),
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+
+	good, err := m.Insert(userID, SnippetInput{Title: "Good", Content: "Good", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A snippet whose data key was wrapped by a master key that is gone.
+	other := &SnippetModel{DB: db, Keys: newTestKeyring(t, newTestKeys(t, "gone")...)}
+
+	bad, err := other.Insert(userID, SnippetInput{Title: "Bad", Content: "Bad", Visibility: VisibilityPublic, Expires: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippets, err := m.ByUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snippets) != 1 || snippets[0].ID != good {
+		t.Errorf("got %d snippets; want only the one that can be decrypted", len(snippets))
+	}
+
+	snippets, total, err := m.List(ListOptions{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("got error %v listing; want the snippet left out", err)
+	}
+	if len(snippets) != 1 || snippets[0].ID != good || total != 1 {
+		t.Errorf("got %d snippets of %d listed; want only the one that can be decrypted", len(snippets), total)
+	}
+
+	// Without master keys, no encrypted snippet is listed or counted.
+	clear := &SnippetModel{DB: db, Logger: m.Logger}
+	if _, total, err = clear.List(ListOptions{Page: 1, PageSize: 10}); err != nil || total != 0 {
+		t.Errorf("got %d snippets listed and error %v without keys; want none", total, err)
+	}
+
+	if !strings.Contains(logs.String(), fmt.Sprintf("id=%d", bad)) {
+		t.Errorf("got logs %q; want the snippet left out logged", logs.String())
+	}
+
+	// Looking the snippet up by itself still fails.
+	if _, err = m.Get(bad, userID); !errors.Is(err, envelope.ErrUnknownKey) {
+		t.Errorf("got error %v; want ErrUnknownKey", err)
+	}
+}
@@ -8,4 +8,5 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrNoMasterKey        = errors.New("models: content is encrypted but no master keys are loaded")
 )
@@ -0,0 +1,64 @@
+// Package memory implements the models store interfaces in process memory.
+// Nothing is persisted, which makes it handy for running the application on
+// a laptop and for exercising handlers without a database.
+package memory
+
+import (
+	"sync"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// DB holds every record for the in-memory stores. The stores share a DB so
+// that, for example, snippets can look up the names of their authors.
+type DB struct {
+	mu        sync.RWMutex
+	users     map[int]*models.User
+	snippets  map[int]*models.Snippet
+	slugs     map[string]int // slug -> snippet ID
+	revisions map[int][]models.Revision
+	tags      map[int][]string // snippet ID -> tags, sorted
+	tokens    map[int]*token
+	lastID    map[string]int
+}
+
+type token struct {
+	models.Token
+	hash string
+}
+
+func New() *DB {
+	return &DB{
+		users:     make(map[int]*models.User),
+		snippets:  make(map[int]*models.Snippet),
+		slugs:     make(map[string]int),
+		revisions: make(map[int][]models.Revision),
+		tags:      make(map[int][]string),
+		tokens:    make(map[int]*token),
+		lastID:    make(map[string]int),
+	}
+}
+
+// nextID returns the next auto-increment value for the named table. The caller
+// must hold the write lock.
+func (db *DB) nextID(table string) int {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+// authorName returns the name of the user with the given ID. The caller must
+// hold the lock.
+func (db *DB) authorName(userID int) string {
+	if u, ok := db.users[userID]; ok {
+		return u.Name
+	}
+	return ""
+}
+
+var (
+	_ models.SnippetStore  = (*SnippetModel)(nil)
+	_ models.UserStore     = (*UserModel)(nil)
+	_ models.RevisionStore = (*RevisionModel)(nil)
+	_ models.TagStore      = (*TagModel)(nil)
+	_ models.TokenStore    = (*TokenModel)(nil)
+)
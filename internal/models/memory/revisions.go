@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"slices"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+type RevisionModel struct {
+	DB *DB
+}
+
+func (m *RevisionModel) All(snippetID int) ([]models.Revision, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	revisions := make([]models.Revision, 0, len(m.DB.revisions[snippetID]))
+	for _, r := range m.DB.revisions[snippetID] {
+		r.Author = m.DB.authorName(r.UserID)
+		revisions = append(revisions, r)
+	}
+	slices.Reverse(revisions)
+
+	return revisions, nil
+}
+
+func (m *RevisionModel) Get(snippetID, number int) (models.Revision, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	for _, r := range m.DB.revisions[snippetID] {
+		if r.Number == number {
+			r.Author = m.DB.authorName(r.UserID)
+			return r, nil
+		}
+	}
+
+	return models.Revision{}, models.ErrNoRecord
+}
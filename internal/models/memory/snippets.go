@@ -0,0 +1,340 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// SnippetModel stores snippets in a DB. SlugLength is the length of new slugs
+// for public and private snippets, or 0 for models.DefaultSlugLength.
+type SnippetModel struct {
+	DB         *DB
+	SlugLength int
+}
+
+func (m *SnippetModel) Insert(userID int, in models.SnippetInput) (int, error) {
+	hashedPassphrase, err := models.HashPassphrase(in.Passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	now := models.Now()
+
+	s := &models.Snippet{
+		ID:         m.DB.nextID("snippets"),
+		Title:      in.Title,
+		Content:    in.Content,
+		Language:   in.Language,
+		Visibility: in.Visibility,
+		Created:    now,
+		Updated:    now,
+		Expires:    now.AddDate(0, 0, in.Expires),
+		UserID:     userID,
+
+		LanguageConfidence: in.LanguageConfidence,
+		HashedPassphrase:   hashedPassphrase,
+		BurnAfterReading:   in.BurnAfterReading,
+		Encrypted:          in.Encrypted,
+	}
+
+	if err := m.DB.setSlug(s, m.SlugLength); err != nil {
+		return 0, err
+	}
+
+	m.DB.snippets[s.ID] = s
+	m.DB.addRevision(s.ID, userID, in.Title, in.Content)
+	m.DB.setTags(s.ID, in.Tags)
+
+	return s.ID, nil
+}
+
+func (m *SnippetModel) Update(id, userID int, in models.SnippetInput) error {
+	hashedPassphrase, err := models.HashPassphrase(in.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	changed := s.Title != in.Title || s.Content != in.Content
+
+	s.Title = in.Title
+	s.Content = in.Content
+	s.Language = in.Language
+	s.LanguageConfidence = in.LanguageConfidence
+	s.Visibility = in.Visibility
+	s.Updated = models.Now()
+	if in.Expires > 0 {
+		s.Expires = s.Updated.AddDate(0, 0, in.Expires)
+	}
+	s.BurnAfterReading = in.BurnAfterReading
+	s.Encrypted = in.Encrypted
+	if hashedPassphrase != nil {
+		s.HashedPassphrase = hashedPassphrase
+	}
+
+	if err := m.DB.setSlug(s, m.SlugLength); err != nil {
+		return err
+	}
+
+	if changed {
+		m.DB.addRevision(id, userID, in.Title, in.Content)
+	}
+
+	m.DB.setTags(id, in.Tags)
+
+	return nil
+}
+
+func (m *SnippetModel) Restore(id, userID, revision int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	i := slices.IndexFunc(m.DB.revisions[id], func(r models.Revision) bool {
+		return r.Number == revision
+	})
+	if i < 0 {
+		return models.ErrNoRecord
+	}
+
+	rev := m.DB.revisions[id][i]
+	s.Title = rev.Title
+	s.Content = rev.Content
+	s.Updated = models.Now()
+	m.DB.addRevision(id, userID, rev.Title, rev.Content)
+
+	return nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	if _, ok := m.DB.snippets[id]; !ok {
+		return models.ErrNoRecord
+	}
+
+	delete(m.DB.slugs, m.DB.snippets[id].Slug)
+	delete(m.DB.snippets, id)
+	delete(m.DB.revisions, id)
+	delete(m.DB.tags, id)
+
+	return nil
+}
+
+func (m *SnippetModel) Get(id, viewerID int) (models.Snippet, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok || !s.Expires.After(models.Now()) || !s.VisibleTo(viewerID) {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+
+	return m.DB.withTags(*s), nil
+}
+
+func (m *SnippetModel) GetBySlug(slug string, viewerID int) (models.Snippet, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	s, ok := m.DB.snippets[m.DB.slugs[slug]]
+	if !ok || !s.Expires.After(models.Now()) ||
+		(s.Visibility == models.VisibilityPrivate && s.UserID != viewerID) {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+
+	return m.DB.withTags(*s), nil
+}
+
+func (m *SnippetModel) Latest() ([]models.Snippet, error) {
+	snippets := m.filter(func(s *models.Snippet) bool { return s.Visibility == models.VisibilityPublic })
+	return snippets[:min(len(snippets), 10)], nil
+}
+
+func (m *SnippetModel) List(opts models.ListOptions) ([]models.Snippet, int, error) {
+	// filter holds the read lock while calling keep, so authorName is safe.
+	snippets := m.filter(func(s *models.Snippet) bool {
+		return s.Visibility == models.VisibilityPublic &&
+			(opts.Author == "" || m.DB.authorName(s.UserID) == opts.Author) &&
+			(opts.Tag == "" || slices.Contains(m.DB.tags[s.ID], opts.Tag)) &&
+			(opts.CreatedFrom.IsZero() || !s.Created.Before(opts.CreatedFrom)) &&
+			(opts.CreatedTo.IsZero() || s.Created.Before(opts.CreatedTo))
+	})
+
+	slices.SortStableFunc(snippets, func(a, b models.Snippet) int {
+		switch opts.Sort {
+		case models.SortOldest:
+			return a.ID - b.ID
+		case models.SortExpiring:
+			if c := a.Expires.Compare(b.Expires); c != 0 {
+				return c
+			}
+			return a.ID - b.ID
+		case models.SortTitle:
+			if c := strings.Compare(a.Title, b.Title); c != 0 {
+				return c
+			}
+			return a.ID - b.ID
+		default:
+			return b.ID - a.ID
+		}
+	})
+
+	return page(snippets, opts), len(snippets), nil
+}
+
+func (m *SnippetModel) ByUser(userID int) ([]models.Snippet, error) {
+	return m.filter(func(s *models.Snippet) bool { return s.UserID == userID }), nil
+}
+
+func (m *SnippetModel) SetPassphrase(id int, passphrase string) error {
+	hashedPassphrase, err := models.HashPassphrase(passphrase)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+
+	s.HashedPassphrase = hashedPassphrase
+
+	return nil
+}
+
+func (m *SnippetModel) Burn(id int) (models.Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	s, ok := m.DB.snippets[id]
+	if !ok || !s.Expires.After(models.Now()) || !s.BurnAfterReading || !s.Burned.IsZero() {
+		return models.Snippet{}, models.ErrNoRecord
+	}
+
+	snippet := m.DB.withAuthor(*s)
+	snippet.Burned = models.Now()
+
+	s.Title = ""
+	s.Content = ""
+	s.Language = ""
+	s.HashedPassphrase = nil
+	s.Burned = snippet.Burned
+	delete(m.DB.revisions, id)
+	delete(m.DB.tags, id)
+
+	return snippet, nil
+}
+
+// filter returns copies of the unexpired snippets that match keep, newest
+// first.
+func (m *SnippetModel) filter(keep func(*models.Snippet) bool) []models.Snippet {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	now := models.Now()
+
+	var snippets []models.Snippet
+	for _, s := range m.DB.snippets {
+		if s.Expires.After(now) && keep(s) {
+			snippets = append(snippets, m.DB.withAuthor(*s))
+		}
+	}
+
+	slices.SortFunc(snippets, func(a, b models.Snippet) int {
+		return b.ID - a.ID
+	})
+
+	return snippets
+}
+
+// withTags returns a copy of the snippet with its author name and tags filled
+// in. The caller must hold the lock.
+func (db *DB) withTags(s models.Snippet) models.Snippet {
+	snippet := db.withAuthor(s)
+	snippet.Tags = slices.Clone(db.tags[s.ID])
+	return snippet
+}
+
+// setTags replaces the tags on a snippet, keeping them sorted. The caller
+// must hold the write lock.
+func (db *DB) setTags(snippetID int, tags []string) {
+	tags = slices.Clone(tags)
+	slices.Sort(tags)
+	db.tags[snippetID] = slices.Compact(tags)
+}
+
+// setSlug gives a snippet a new, unused slug if models.NeedsSlug says it
+// needs one. The caller must hold the write lock.
+func (db *DB) setSlug(s *models.Snippet, configured int) error {
+	if !models.NeedsSlug(s.Slug, s.Visibility) {
+		return nil
+	}
+
+	length := models.SlugLength(configured, s.Visibility)
+
+	for i := 0; i < models.MaxSlugAttempts; i++ {
+		slug, err := models.NewSlug(length)
+		if err != nil {
+			return err
+		}
+
+		if _, taken := db.slugs[slug]; !taken {
+			delete(db.slugs, s.Slug)
+			db.slugs[slug] = s.ID
+			s.Slug = slug
+			return nil
+		}
+	}
+
+	return models.ErrSlugExhausted
+}
+
+// page returns the slice of snippets selected by opts.
+func page(snippets []models.Snippet, opts models.ListOptions) []models.Snippet {
+	start := min((opts.Page-1)*opts.PageSize, len(snippets))
+	end := min(start+opts.PageSize, len(snippets))
+	return snippets[start:end]
+}
+
+// withAuthor fills in the Author field of a snippet. The caller must hold the
+// lock.
+func (db *DB) withAuthor(s models.Snippet) models.Snippet {
+	s.Author = db.authorName(s.UserID)
+	return s
+}
+
+// addRevision appends the next revision of a snippet. The caller must hold the
+// write lock.
+func (db *DB) addRevision(snippetID, userID int, title, content string) {
+	revs := db.revisions[snippetID]
+	db.revisions[snippetID] = append(revs, models.Revision{
+		ID:        db.nextID("snippet_revisions"),
+		SnippetID: snippetID,
+		Number:    len(revs) + 1,
+		Title:     title,
+		Content:   content,
+		Created:   models.Now(),
+		UserID:    userID,
+	})
+}
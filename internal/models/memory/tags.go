@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+type TagModel struct {
+	DB *DB
+}
+
+func (m *TagModel) Counts() ([]models.TagCount, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	now := models.Now()
+	counts := make(map[string]int)
+
+	for id, tags := range m.DB.tags {
+		if s, ok := m.DB.snippets[id]; ok && s.Expires.After(now) && s.Visibility == models.VisibilityPublic {
+			for _, tag := range tags {
+				counts[tag]++
+			}
+		}
+	}
+
+	result := make([]models.TagCount, 0, len(counts))
+	for name, n := range counts {
+		result = append(result, models.TagCount{Name: name, Count: n})
+	}
+
+	slices.SortFunc(result, func(a, b models.TagCount) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"slices"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+type TokenModel struct {
+	DB *DB
+}
+
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	plaintext, hash, err := models.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	id := m.DB.nextID("api_tokens")
+	m.DB.tokens[id] = &token{
+		Token: models.Token{
+			ID:      id,
+			UserID:  userID,
+			Name:    name,
+			Scope:   scope,
+			Created: models.Now(),
+		},
+		hash: hash,
+	}
+
+	return plaintext, nil
+}
+
+func (m *TokenModel) ForUser(userID int) ([]models.Token, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	var tokens []models.Token
+	for _, t := range m.DB.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t.Token)
+		}
+	}
+
+	slices.SortFunc(tokens, func(a, b models.Token) int {
+		return b.ID - a.ID
+	})
+
+	return tokens, nil
+}
+
+func (m *TokenModel) Revoke(id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	t, ok := m.DB.tokens[id]
+	if !ok || t.UserID != userID {
+		return models.ErrNoRecord
+	}
+
+	delete(m.DB.tokens, id)
+
+	return nil
+}
+
+func (m *TokenModel) Authenticate(plaintext string) (models.Token, error) {
+	hash := models.HashToken(plaintext)
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, t := range m.DB.tokens {
+		if t.hash == hash {
+			t.LastUsed = models.Now()
+			return t.Token, nil
+		}
+	}
+
+	return models.Token{}, models.ErrInvalidCredentials
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"errors"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserModel struct {
+	DB *DB
+}
+
+func (m *UserModel) Insert(name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			return models.ErrDuplicateEmail
+		}
+	}
+
+	id := m.DB.nextID("users")
+	m.DB.users[id] = &models.User{
+		ID:             id,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        models.Now(),
+	}
+
+	return nil
+}
+
+func (m *UserModel) Anonymous() (int, error) {
+	if id, ok := m.byEmail(models.AnonymousEmail); ok {
+		return id, nil
+	}
+
+	password, _, err := models.GenerateToken()
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.Insert(models.AnonymousName, models.AnonymousEmail, password)
+	if err != nil && !errors.Is(err, models.ErrDuplicateEmail) {
+		return 0, err
+	}
+
+	id, _ := m.byEmail(models.AnonymousEmail)
+	return id, nil
+}
+
+func (m *UserModel) byEmail(email string) (int, bool) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			return u.ID, true
+		}
+	}
+	return 0, false
+}
+
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	m.DB.mu.RLock()
+	var found *models.User
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			found = u
+			break
+		}
+	}
+	m.DB.mu.RUnlock()
+
+	if found == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(found.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return found.ID, nil
+}
+
+func (m *UserModel) Get(id int) (models.User, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	u, ok := m.DB.users[id]
+	if !ok {
+		return models.User{}, models.ErrNoRecord
+	}
+
+	result := *u
+	result.HashedPassword = nil
+
+	return result, nil
+}
+
+func (m *UserModel) Exists(id int) (bool, error) {
+	m.DB.mu.RLock()
+	defer m.DB.mu.RUnlock()
+
+	_, ok := m.DB.users[id]
+
+	return ok, nil
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passphrase lengths. bcrypt ignores everything after the 72nd byte, so
+// longer passphrases are refused rather than silently truncated.
+const (
+	MinPassphraseLength = 8
+	MaxPassphraseBytes  = 72
+)
+
+// Protected reports whether the snippet's content is protected by a
+// passphrase.
+func (s Snippet) Protected() bool {
+	return len(s.HashedPassphrase) > 0
+}
+
+// CheckPassphrase returns ErrInvalidCredentials unless passphrase is the one
+// protecting the snippet.
+func (s Snippet) CheckPassphrase(passphrase string) error {
+	err := bcrypt.CompareHashAndPassword(s.HashedPassphrase, []byte(passphrase))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrHashTooShort) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	return nil
+}
+
+// HashPassphrase hashes a snippet passphrase the same way UserModel.Insert
+// hashes passwords. The empty passphrase hashes to nil, meaning none.
+func HashPassphrase(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, nil
+	}
+	return bcrypt.GenerateFromPassword([]byte(passphrase), 12)
+}
+
+// passphraseValue returns the value to store in snippets.hashed_passphrase
+// for a passphrase: its hash, or NULL rather than an empty hash when there is
+// none, so that queries can pick out protected snippets with IS NULL.
+func passphraseValue(passphrase string) (any, error) {
+	hashedPassphrase, err := HashPassphrase(passphrase)
+	if err != nil || hashedPassphrase == nil {
+		return nil, err
+	}
+	return hashedPassphrase, nil
+}
+
+// SetPassphrase protects a snippet's content with a passphrase, replacing any
+// it had before. The empty passphrase removes the protection.
+func (m *SnippetModel) SetPassphrase(id int, passphrase string) error {
+	value, err := passphraseValue(passphrase)
+	if err != nil {
+		return err
+	}
+
+	stmt := `UPDATE snippets SET hashed_passphrase = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, value, id)
+	return err
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/envelope"
+)
+
+// Revision is a saved copy of a snippet's title and content. Revisions are
+// numbered from 1 for each snippet.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Number    int
+	Title     string
+	Content   string
+	Created   time.Time
+	UserID    int
+	Author    string
+}
+
+// RevisionModel reads snippet revisions, decrypting their content with Keys
+// if it was encrypted along with the snippet's.
+type RevisionModel struct {
+	DB   *sql.DB
+	Keys *envelope.Keyring
+}
+
+// All returns every revision of a snippet, newest first.
+func (m *RevisionModel) All(snippetID int) ([]Revision, error) {
+	query := `SELECT r.id, r.snippet_id, r.revision, r.title, r.content, r.created, r.user_id, u.name,
+	COALESCE(s.content_key, '')
+	FROM snippet_revisions r INNER JOIN users u ON u.id = r.user_id
+	INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.snippet_id = ?
+	ORDER BY r.revision DESC`
+
+	rows, err := m.DB.Query(query, snippetID)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []Revision
+
+	for rows.Next() {
+		var r Revision
+		var contentKey string
+
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.Number, &r.Title, &r.Content, &r.Created, &r.UserID, &r.Author, &contentKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = m.open(&r, contentKey); err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (m *RevisionModel) Get(snippetID, number int) (Revision, error) {
+	query := `SELECT r.id, r.snippet_id, r.revision, r.title, r.content, r.created, r.user_id, u.name,
+	COALESCE(s.content_key, '')
+	FROM snippet_revisions r INNER JOIN users u ON u.id = r.user_id
+	INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.snippet_id = ? AND r.revision = ?`
+
+	var r Revision
+	var contentKey string
+
+	err := m.DB.QueryRow(query, snippetID, number).Scan(&r.ID, &r.SnippetID, &r.Number, &r.Title, &r.Content, &r.Created, &r.UserID, &r.Author, &contentKey)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		} else {
+			return Revision{}, err
+		}
+	}
+
+	if err = m.open(&r, contentKey); err != nil {
+		return Revision{}, err
+	}
+
+	return r, nil
+}
+
+// open decrypts the content of a revision encrypted with its snippet's data
+// key.
+func (m *RevisionModel) open(r *Revision, contentKey string) error {
+	key, err := unwrapContentKey(m.Keys, contentKey)
+	if err != nil {
+		return err
+	}
+
+	r.Content, err = openContent(key, r.Content)
+
+	return err
+}
+
+// insertRevision records the given title and content as the next revision of
+// a snippet. It runs inside the transaction that changed the snippet so the
+// history can never disagree with the snippet itself.
+func insertRevision(tx *sql.Tx, snippetID, userID int, title, content string, created time.Time) error {
+	query := `INSERT INTO snippet_revisions (snippet_id, revision, title, content, created, user_id)
+	SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ?
+	FROM snippet_revisions WHERE snippet_id = ?`
+
+	_, err := tx.Exec(query, snippetID, title, content, created, userID, snippetID)
+
+	return err
+}
+
+// latestRevision returns the most recent revision of a snippet, or
+// ErrNoRecord if none has been recorded.
+func latestRevision(tx *sql.Tx, snippetID int) (Revision, error) {
+	query := `SELECT id, snippet_id, revision, title, content, created, user_id
+	FROM snippet_revisions WHERE snippet_id = ?
+	ORDER BY revision DESC LIMIT 1`
+
+	var r Revision
+
+	err := tx.QueryRow(query, snippetID).Scan(&r.ID, &r.SnippetID, &r.Number, &r.Title, &r.Content, &r.Created, &r.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		}
+		return Revision{}, err
+	}
+
+	return r, nil
+}
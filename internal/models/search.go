@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// SearchResult is a snippet matched by a full-text search. Score is the
+// backend's relevance score; it is only meaningful for ordering results from
+// the same search.
+type SearchResult struct {
+	Snippet
+	Score float64
+}
+
+// SearchModel answers searches over public snippets that are neither protected
+// by a passphrase nor encrypted, with the MySQL FULLTEXT index on
+// snippets(title, content). It relies on natural language mode, so words
+// shorter than innodb_ft_min_token_size and stopwords never match. Content
+// encrypted at rest can't be matched, so it is only used without master keys.
+type SearchModel struct {
+	DB *sql.DB
+}
+
+func (m *SearchModel) Search(query string, page, pageSize int) ([]SearchResult, int, error) {
+	var total int
+
+	stmt := `SELECT COUNT(*) FROM snippets s
+	WHERE MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) AND s.expires > ? AND s.visibility = ? AND s.hashed_passphrase IS NULL AND s.encrypted = ? AND s.content_key IS NULL`
+
+	err := m.DB.QueryRow(stmt, query, Now(), VisibilityPublic, false).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt = `SELECT ` + snippetColumns + `,
+	MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) AS score
+	FROM snippets s JOIN users u ON u.id = s.user_id
+	WHERE MATCH(s.title, s.content) AGAINST(? IN NATURAL LANGUAGE MODE) AND s.expires > ? AND s.visibility = ? AND s.hashed_passphrase IS NULL AND s.encrypted = ? AND s.content_key IS NULL
+	ORDER BY score DESC, s.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(stmt, query, query, Now(), VisibilityPublic, false, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+
+	for rows.Next() {
+		var r SearchResult
+
+		err = rows.Scan(append(r.dest(), &r.Score)...)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// slugAlphabet is base62, so slugs need no escaping in URLs.
+const slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Slug lengths. Public and private snippets get slugs of the configured
+// length, which only need to be too many to count through. Unlisted snippets
+// are protected by nothing but their link, so their slugs are always long
+// enough, at about 131 bits, that they can't be guessed.
+const (
+	DefaultSlugLength  = 8
+	MinSlugLength      = 6
+	MaxSlugLength      = 22
+	unlistedSlugLength = MaxSlugLength
+)
+
+// MaxSlugAttempts bounds the search for an unused slug. Running out means the
+// configured length is far too short for the number of snippets.
+const MaxSlugAttempts = 10
+
+// ErrSlugExhausted is returned when no unused slug could be found.
+var ErrSlugExhausted = errors.New("models: could not find an unused slug; increase the slug length")
+
+// NewSlug returns a random base62 identifier of the given length. Slugs
+// always contain a letter, so they can't be mistaken for a numeric ID.
+func NewSlug(length int) (string, error) {
+	max := big.NewInt(int64(len(slugAlphabet)))
+
+	b := make([]byte, length)
+
+	for {
+		for i := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			b[i] = slugAlphabet[n.Int64()]
+		}
+
+		if strings.ContainsAny(string(b), slugAlphabet[10:]) {
+			return string(b), nil
+		}
+	}
+}
+
+// SlugLength returns the length of slug to give a snippet with the given
+// visibility, where configured is the length chosen by the operator, or 0 for
+// the default.
+func SlugLength(configured int, visibility string) int {
+	if visibility == VisibilityUnlisted {
+		return unlistedSlugLength
+	}
+	if configured == 0 {
+		return DefaultSlugLength
+	}
+	return configured
+}
+
+// NeedsSlug reports whether a snippet with the given slug must be given a new
+// one when it is saved with the given visibility. Snippets keep their slugs so
+// that links to them keep working, except that one being unlisted with a slug
+// too short to be unguessable gets a longer one.
+func NeedsSlug(slug, visibility string) bool {
+	return slug == "" || (visibility == VisibilityUnlisted && len(slug) < unlistedSlugLength)
+}
+
+// IsNumericKey reports whether a snippet key from a URL is a numeric ID from
+// before snippets had slugs, rather than a slug.
+func IsNumericKey(key string) bool {
+	return key != "" && strings.Trim(key, "0123456789") == ""
+}
+
+// uniqueSlug returns a slug of the given length that no snippet uses yet.
+// The unique constraint on snippets.slug still guards against a concurrent
+// insert taking the same slug.
+func uniqueSlug(tx *sql.Tx, length int) (string, error) {
+	for i := 0; i < MaxSlugAttempts; i++ {
+		slug, err := NewSlug(length)
+		if err != nil {
+			return "", err
+		}
+
+		var exists bool
+
+		err = tx.QueryRow(`SELECT EXISTS(SELECT true FROM snippets WHERE slug = ?)`, slug).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return slug, nil
+		}
+	}
+
+	return "", ErrSlugExhausted
+}
+
+// AssignSlugs gives a slug to every snippet that does not have one yet, such
+// as those created before snippets had slugs. It returns the number of
+// snippets given a slug.
+func (m *SnippetModel) AssignSlugs() (int, error) {
+	rows, err := m.DB.Query(`SELECT id, visibility FROM snippets WHERE slug IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	visibilities := make(map[int]string)
+
+	for rows.Next() {
+		var (
+			id         int
+			visibility string
+		)
+
+		if err = rows.Scan(&id, &visibility); err != nil {
+			return 0, err
+		}
+
+		visibilities[id] = visibility
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, visibility := range visibilities {
+		if err = m.assignSlug(id, visibility); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(visibilities), nil
+}
+
+func (m *SnippetModel) assignSlug(id int, visibility string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	slug, err := uniqueSlug(tx, SlugLength(m.SlugLength, visibility))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE snippets SET slug = ? WHERE id = ? AND slug IS NULL`, slug, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
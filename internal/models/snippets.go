@@ -3,26 +3,243 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/fayazp088/snippet-box/internal/envelope"
+)
+
+// Visibility levels. Public snippets are listed and searchable; unlisted
+// snippets can be seen by anyone with their link; private snippets can only
+// be seen by their author.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
 )
 
+// Visibilities lists the valid visibility levels.
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// Snippet is a paste. LanguageConfidence is set when the language was
+// detected automatically rather than chosen by the author, and says how sure
+// the detector was, from 0 to 1. Updated is when the snippet was last
+// created, edited or restored. Slug is the random identifier that stands in
+// for ID in links, so that snippets can't be found by counting; ID is only
+// used internally. HashedPassphrase is the bcrypt hash of the passphrase
+// protecting the snippet's content, or nil if it has none. A snippet marked
+// BurnAfterReading is deleted by Burn the first time it is read, after which
+// only Burned, the time it was read, is left of it. The Content of an
+// Encrypted snippet was encrypted in the author's browser with a key the
+// server never sees.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID                 int
+	Title              string
+	Content            string
+	Language           string
+	LanguageConfidence float64
+	Visibility         string
+	Slug               string
+	Created            time.Time
+	Updated            time.Time
+	Expires            time.Time
+	UserID             int
+	Author             string
+	Tags               []string
+	HashedPassphrase   []byte
+	BurnAfterReading   bool
+	Burned             time.Time
+	Encrypted          bool
+
+	// contentKey is the wrapped data key that Content is encrypted with in
+	// the database, or empty if it is stored in clear text.
+	contentKey string
+}
+
+// Key returns the identifier used for the snippet in links: its slug, or its
+// ID if it has not been given a slug yet.
+func (s Snippet) Key() string {
+	if s.Slug != "" {
+		return s.Slug
+	}
+	return strconv.Itoa(s.ID)
+}
+
+// VisibleTo reports whether the user with the given ID, or 0 for an
+// anonymous visitor, may see the snippet when it is looked up by ID.
+func (s Snippet) VisibleTo(userID int) bool {
+	return s.Visibility == VisibilityPublic || (userID != 0 && s.UserID == userID)
 }
 
+// snippetColumns are the columns selected into a Snippet by queries over
+// snippets s joined to users u, in the order of Snippet.dest.
+const snippetColumns = `s.id, s.title, s.content, s.language, s.language_confidence, s.visibility,
+	COALESCE(s.slug, ''), s.created, s.updated, s.expires, s.user_id, u.name, s.hashed_passphrase,
+	s.burn_after_reading, s.burned, s.encrypted, COALESCE(s.content_key, '')`
+
+// dest returns pointers to the fields that snippetColumns are scanned into.
+func (s *Snippet) dest() []any {
+	return []any{&s.ID, &s.Title, &s.Content, &s.Language, &s.LanguageConfidence, &s.Visibility,
+		&s.Slug, &s.Created, &s.Updated, &s.Expires, &s.UserID, &s.Author, &s.HashedPassphrase,
+		&s.BurnAfterReading, nullTime{&s.Burned}, &s.Encrypted, &s.contentKey}
+}
+
+// SnippetInput holds the fields of a snippet chosen by its author, as passed
+// to Insert and Update. Language is a highlight language ID, or empty for
+// plain text, and LanguageConfidence is non-zero if it was detected.
+// Visibility is one of Visibilities. Expires is the number of days the
+// snippet should live for; an update with 0 keeps its current expiry.
+// Passphrase, if not empty, protects the snippet's
+// content; an update without one keeps the snippet's current passphrase, which
+// only SetPassphrase can remove. BurnAfterReading marks the snippet to be
+// deleted when it is first read, and Encrypted says that Content is
+// ciphertext. Tags replace the snippet's tags, and are expected to be
+// normalized already.
+type SnippetInput struct {
+	Title              string
+	Content            string
+	Language           string
+	LanguageConfidence float64
+	Visibility         string
+	Expires            int
+	Passphrase         string
+	BurnAfterReading   bool
+	Encrypted          bool
+	Tags               []string
+}
+
+// Sort orders accepted by ListOptions.
+const (
+	SortNewest   = "newest"
+	SortOldest   = "oldest"
+	SortExpiring = "expiring"
+	SortTitle    = "title"
+)
+
+// SortOrders lists the valid values of ListOptions.Sort.
+var SortOrders = []string{SortNewest, SortOldest, SortExpiring, SortTitle}
+
+// ListOptions selects a page of snippets. Pages are numbered from 1. Author,
+// when set, restricts the list to snippets by users with that name, Tag to
+// snippets carrying that tag, and CreatedFrom and CreatedTo, when non-zero,
+// to snippets created at or after and strictly before those times.
+type ListOptions struct {
+	Page        int
+	PageSize    int
+	Sort        string
+	Author      string
+	Tag         string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+func (o ListOptions) limit() int {
+	return o.PageSize
+}
+
+func (o ListOptions) offset() int {
+	return (o.Page - 1) * o.PageSize
+}
+
+// orderBy returns the ORDER BY clause for the sort order. Ties are broken by
+// ID so that pagination is stable.
+func (o ListOptions) orderBy() string {
+	switch o.Sort {
+	case SortOldest:
+		return "s.id ASC"
+	case SortExpiring:
+		return "s.expires ASC, s.id ASC"
+	case SortTitle:
+		return "s.title ASC, s.id ASC"
+	default:
+		return "s.id DESC"
+	}
+}
+
+// where returns the WHERE clause and arguments selecting the unexpired
+// public snippets that match the filters.
+func (o ListOptions) where() (string, []any) {
+	conditions := []string{"s.expires > ?", "s.visibility = ?"}
+	args := []any{Now(), VisibilityPublic}
+
+	if o.Author != "" {
+		conditions = append(conditions, "u.name = ?")
+		args = append(args, o.Author)
+	}
+	if o.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT true FROM snippet_tags st
+		INNER JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id AND t.name = ?)`)
+		args = append(args, o.Tag)
+	}
+	if !o.CreatedFrom.IsZero() {
+		conditions = append(conditions, "s.created >= ?")
+		args = append(args, o.CreatedFrom.UTC())
+	}
+	if !o.CreatedTo.IsZero() {
+		conditions = append(conditions, "s.created < ?")
+		args = append(args, o.CreatedTo.UTC())
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// SnippetModel stores snippets in MySQL or SQLite. SlugLength is the length
+// of new slugs for public and private snippets, or 0 for DefaultSlugLength.
+// If Keys is set, the content of new snippets and their revisions is
+// encrypted with a data key of their own, wrapped by the primary master key;
+// see encryption.go. Logger records snippets left out of listings because
+// their content can't be decrypted; it defaults to slog.Default().
 type SnippetModel struct {
-	DB *sql.DB
+	DB         *sql.DB
+	SlugLength int
+	Keys       *envelope.Keyring
+	Logger     *slog.Logger
 }
 
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	query := `INSERT INTO snippets (title, content, created, expires) 
-           VALUES (?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+func (m *SnippetModel) logger() *slog.Logger {
+	if m.Logger == nil {
+		return slog.Default()
+	}
+	return m.Logger
+}
 
-	result, err := m.DB.Exec(query, title, content, expires)
+func (m *SnippetModel) Insert(userID int, in SnippetInput) (int, error) {
+	// Hash the passphrase before starting the transaction: bcrypt is slow on
+	// purpose, and SQLite would hold its write lock all the while.
+	hashedPassphrase, err := passphraseValue(in.Passphrase)
+	if err != nil {
+		return 0, err
+	}
+
+	key, contentKey, err := m.newContentKey()
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := sealContent(key, in.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := Now()
+
+	slug, err := uniqueSlug(tx, SlugLength(m.SlugLength, in.Visibility))
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO snippets (title, content, language, language_confidence, visibility, slug, created, updated, expires, user_id, hashed_passphrase, burn_after_reading, encrypted, content_key) 
+           VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.Exec(query, in.Title, content, in.Language, in.LanguageConfidence, in.Visibility, slug, now, now, now.AddDate(0, 0, in.Expires), userID, hashedPassphrase, in.BurnAfterReading, in.Encrypted, contentKey)
 
 	if err != nil {
 		return 0, err
@@ -34,39 +251,293 @@ func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
 		return 0, err
 	}
 
+	if err = insertRevision(tx, int(id), userID, in.Title, content, now); err != nil {
+		return 0, err
+	}
+
+	if err = setTags(tx, int(id), in.Tags); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return int(id), nil
 }
 
-func (m *SnippetModel) Get(id int) (Snippet, error) {
-	query := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+// Update changes a snippet on behalf of userID. A new revision is recorded
+// whenever the title or content actually changes. Content stays encrypted, or
+// in clear text, as it was; the keys command encrypts older snippets.
+func (m *SnippetModel) Update(id, userID int, in SnippetInput) error {
+	hashedPassphrase, err := passphraseValue(in.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := Now()
+
+	// Touching the row first locks it, so that content_key can't change
+	// between reading it and writing content sealed with it, as it would if
+	// EncryptAll got to the snippet in between.
+	if _, err = tx.Exec(`UPDATE snippets SET updated = ? WHERE id = ?`, now, id); err != nil {
+		return err
+	}
+
+	var slug, contentKey sql.NullString
+
+	err = tx.QueryRow(`SELECT slug, content_key FROM snippets WHERE id = ?`, id).Scan(&slug, &contentKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	key, err := unwrapContentKey(m.Keys, contentKey.String)
+	if err != nil {
+		return err
+	}
+
+	content, err := sealContent(key, in.Content)
+	if err != nil {
+		return err
+	}
+
+	if NeedsSlug(slug.String, in.Visibility) {
+		slug.String, err = uniqueSlug(tx, SlugLength(m.SlugLength, in.Visibility))
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE snippets SET title = ?, content = ?, language = ?, language_confidence = ?, visibility = ?,
+	slug = ?, updated = ?, expires = COALESCE(?, expires), hashed_passphrase = COALESCE(?, hashed_passphrase), burn_after_reading = ?,
+	encrypted = ?
+	WHERE id = ?`
+
+	var expires any
+	if in.Expires > 0 {
+		expires = now.AddDate(0, 0, in.Expires)
+	}
+
+	_, err = tx.Exec(query, in.Title, content, in.Language, in.LanguageConfidence, in.Visibility, slug.String, now, expires, hashedPassphrase, in.BurnAfterReading, in.Encrypted, id)
+	if err != nil {
+		return err
+	}
+
+	// Snippets saved before revisions were recorded have none, and get their
+	// first one now.
+	latest, err := latestRevision(tx, id)
+	found := err == nil
+	if err != nil && !errors.Is(err, ErrNoRecord) {
+		return err
+	}
+
+	if found {
+		latest.Content, err = openContent(key, latest.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !found || in.Title != latest.Title || in.Content != latest.Content {
+		if err = insertRevision(tx, id, userID, in.Title, content, now); err != nil {
+			return err
+		}
+	}
+
+	if err = setTags(tx, id, in.Tags); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore rolls a snippet back to the title and content of an earlier
+// revision. The rollback is itself recorded as a new revision. Revisions are
+// encrypted with the snippet's data key, so their content is copied as it is.
+func (m *SnippetModel) Restore(id, userID, revision int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := Now()
+
+	// Lock the row before reading the revision, as Update does, so that
+	// EncryptAll can't encrypt the revisions in between.
+	if _, err = tx.Exec(`UPDATE snippets SET updated = ? WHERE id = ?`, now, id); err != nil {
+		return err
+	}
+
+	var title, content string
+
+	query := `SELECT title, content FROM snippet_revisions WHERE snippet_id = ? AND revision = ?`
+
+	err = tx.QueryRow(query, id, revision).Scan(&title, &content)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	query = `UPDATE snippets SET title = ?, content = ?, updated = ? WHERE id = ?`
+
+	_, err = tx.Exec(query, title, content, now, id)
+	if err != nil {
+		return err
+	}
+
+	if err = insertRevision(tx, id, userID, title, content, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	query := `DELETE FROM snippets WHERE id = ?`
+
+	result, err := m.DB.Exec(query, id)
 
-	row := m.DB.QueryRow(query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Get returns the snippet with the given ID if viewerID, the ID of the user
+// asking or 0 for an anonymous visitor, may see it. Only public snippets can
+// be looked up by ID by anyone but their author; unlisted snippets must be
+// looked up with GetBySlug.
+func (m *SnippetModel) Get(id, viewerID int) (Snippet, error) {
+	query := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.id = ? AND (s.visibility = ? OR s.user_id = ?)`
+
+	return m.get(query, Now(), id, VisibilityPublic, viewerID)
+}
+
+// GetBySlug returns the snippet with the given slug if viewerID may see it:
+// anyone may see public and unlisted snippets this way, but private ones are
+// still only visible to their author.
+func (m *SnippetModel) GetBySlug(slug string, viewerID int) (Snippet, error) {
+	query := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.slug = ? AND (s.visibility <> ? OR s.user_id = ?)`
+
+	return m.get(query, Now(), slug, VisibilityPrivate, viewerID)
+}
+
+func (m *SnippetModel) get(query string, args ...any) (Snippet, error) {
 	var snippet Snippet
 
-	err := row.Scan(&snippet.ID, &snippet.Title, &snippet.Content, &snippet.Created, &snippet.Expires)
+	err := m.DB.QueryRow(query, args...).Scan(snippet.dest()...)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Snippet{}, ErrNoRecord
 		} else {
-			return Snippet{}, nil
+			return Snippet{}, err
 		}
 	}
 
+	if err = m.open(&snippet); err != nil {
+		return Snippet{}, err
+	}
+
+	snippet.Tags, err = m.snippetTags(snippet.ID)
+	if err != nil {
+		return Snippet{}, err
+	}
+
 	return snippet, nil
 }
 
+// Latest returns the ten newest unexpired public snippets.
 func (m *SnippetModel) Latest() ([]Snippet, error) {
 
-	query := `SELECT id, title, content, created, expires 
-	FROM snippets WHERE expires > UTC_TIMESTAMP() 
-	ORDER BY id DESC LIMIT 10`
+	query := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.visibility = ?
+	ORDER BY s.id DESC LIMIT 10`
 
-	rows, err := m.DB.Query(query)
+	return m.list(query, Now(), VisibilityPublic)
+}
+
+// List returns a page of unexpired snippets matching the options, along with
+// the total number of matching snippets. Snippets encrypted under a master key
+// that isn't loaded are left out of both, so that the total matches the pages.
+// A snippet that still fails to decrypt, which means its data key or content
+// is corrupt, is counted but left out of its page.
+func (m *SnippetModel) List(opts ListOptions) ([]Snippet, int, error) {
+	where, args := opts.where()
+
+	readable, readableArgs := m.readable()
+	where += " AND " + readable
+	args = append(args, readableArgs...)
+
+	var total int
+
+	query := `SELECT COUNT(*) FROM snippets s INNER JOIN users u ON u.id = s.user_id WHERE ` + where
+
+	err := m.DB.QueryRow(query, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE ` + where + `
+	ORDER BY ` + opts.orderBy() + ` LIMIT ? OFFSET ?`
+
+	snippets, err := m.list(query, append(args, opts.limit(), opts.offset())...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// ByUser returns every unexpired snippet created by the given user, whatever
+// its visibility, newest first.
+func (m *SnippetModel) ByUser(userID int) ([]Snippet, error) {
+	query := `SELECT ` + snippetColumns + `
+	FROM snippets s INNER JOIN users u ON u.id = s.user_id
+	WHERE s.expires > ? AND s.user_id = ?
+	ORDER BY s.id DESC`
+
+	return m.list(query, Now(), userID)
+}
+
+// list runs a query for snippets. A snippet whose content can't be decrypted,
+// say because its master key is no longer loaded, is logged and left out
+// rather than failing the whole listing.
+func (m *SnippetModel) list(query string, args ...any) ([]Snippet, error) {
+	rows, err := m.DB.Query(query, args...)
 
 	if err != nil {
-		return []Snippet{}, nil
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -75,14 +546,23 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	for rows.Next() {
 		var s Snippet
 
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(s.dest()...)
 
 		if err != nil {
 			return nil, err
 		}
 
+		if err = m.open(&s); err != nil {
+			m.logger().Error("leaving snippet out of listing", "id", s.ID, "error", err)
+			continue
+		}
+
 		snippets = append(snippets, s)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return snippets, nil
 }
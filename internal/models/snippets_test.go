@@ -0,0 +1,115 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnippetModelVisibility(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+
+	authorID := newTestUser(t, db, "alice")
+	otherID := newTestUser(t, db, "bob")
+
+	snippets := make(map[string]Snippet)
+	for _, visibility := range []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, "expired"} {
+		in := SnippetInput{Title: visibility, Content: visibility, Visibility: visibility, Expires: 7}
+		if visibility == "expired" {
+			in.Visibility = VisibilityPublic
+		}
+
+		id, err := m.Insert(authorID, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snippets[visibility], err = m.Get(id, authorID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := db.Exec(`UPDATE snippets SET expires = ? WHERE id = ?`, Now().AddDate(0, 0, -1), snippets["expired"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlisted snippets can be found by slug, but not by counting IDs.
+	tests := []struct {
+		visibility string
+		viewerID   int
+		wantByID   bool
+		wantBySlug bool
+	}{
+		{VisibilityPublic, authorID, true, true},
+		{VisibilityPublic, otherID, true, true},
+		{VisibilityPublic, 0, true, true},
+		{VisibilityUnlisted, authorID, true, true},
+		{VisibilityUnlisted, otherID, false, true},
+		{VisibilityUnlisted, 0, false, true},
+		{VisibilityPrivate, authorID, true, true},
+		{VisibilityPrivate, otherID, false, false},
+		{VisibilityPrivate, 0, false, false},
+		{"expired", authorID, false, false},
+		{"expired", 0, false, false},
+	}
+
+	viewers := map[int]string{authorID: "author", otherID: "other user", 0: "anonymous"}
+
+	for _, tt := range tests {
+		t.Run(tt.visibility+" to "+viewers[tt.viewerID], func(t *testing.T) {
+			s := snippets[tt.visibility]
+
+			_, err := m.Get(s.ID, tt.viewerID)
+			if got := err == nil; got != tt.wantByID || (err != nil && !errors.Is(err, ErrNoRecord)) {
+				t.Errorf("Get: got error %v; want found %t", err, tt.wantByID)
+			}
+
+			_, err = m.GetBySlug(s.Slug, tt.viewerID)
+			if got := err == nil; got != tt.wantBySlug || (err != nil && !errors.Is(err, ErrNoRecord)) {
+				t.Errorf("GetBySlug: got error %v; want found %t", err, tt.wantBySlug)
+			}
+		})
+	}
+}
+
+func TestSnippetModelUpdateExpires(t *testing.T) {
+	db := newTestDB(t)
+	userID := newTestUser(t, db, "alice")
+	m := &SnippetModel{DB: db}
+
+	tests := []struct {
+		name     string
+		expires  int
+		wantDays int
+	}{
+		{"Keep the current expiry", 0, 365},
+		{"Choose a new expiry", 7, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := m.Insert(userID, SnippetInput{Title: "Hello", Content: "Hello", Visibility: VisibilityPublic, Expires: 365})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Update(id, userID, SnippetInput{Title: "Hello", Content: "Hello, world", Visibility: VisibilityPublic, Expires: tt.expires})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			snippet, err := m.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := snippet.Created.AddDate(0, 0, tt.wantDays)
+			if d := snippet.Expires.Sub(want); d < -time.Minute || d > time.Minute {
+				t.Errorf("got expiry %v; want %v", snippet.Expires, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// The store interfaces describe everything the web application needs from
+// its storage backend. The *Model types in this package implement them on top
+// of database/sql and work with both MySQL and SQLite; the memory package
+// provides an in-process implementation for local use and tests.
+
+type SnippetStore interface {
+	Insert(userID int, in SnippetInput) (int, error)
+	Update(id, userID int, in SnippetInput) error
+	Restore(id, userID, revision int) error
+	Delete(id int) error
+	Get(id, viewerID int) (Snippet, error)
+	GetBySlug(slug string, viewerID int) (Snippet, error)
+	Latest() ([]Snippet, error)
+	List(opts ListOptions) ([]Snippet, int, error)
+	ByUser(userID int) ([]Snippet, error)
+	SetPassphrase(id int, passphrase string) error
+	Burn(id int) (Snippet, error)
+}
+
+// SnippetSearcher finds unexpired public snippets whose title or content match a
+// free-text query, best matches first. It returns one page of results and the
+// total number of matches. Snippets protected by a passphrase are never
+// found, as matching their content would give it away, and nor are encrypted
+// snippets, whose content can't be matched.
+type SnippetSearcher interface {
+	Search(query string, page, pageSize int) ([]SearchResult, int, error)
+}
+
+type UserStore interface {
+	Insert(name, email, password string) error
+	Anonymous() (int, error)
+	Authenticate(email, password string) (int, error)
+	Get(id int) (User, error)
+	Exists(id int) (bool, error)
+}
+
+type RevisionStore interface {
+	All(snippetID int) ([]Revision, error)
+	Get(snippetID, number int) (Revision, error)
+}
+
+type TagStore interface {
+	Counts() ([]TagCount, error)
+}
+
+type TokenStore interface {
+	Insert(userID int, name, scope string) (string, error)
+	ForUser(userID int) ([]Token, error)
+	Revoke(id, userID int) error
+	Authenticate(plaintext string) (Token, error)
+}
+
+var (
+	_ SnippetStore    = (*SnippetModel)(nil)
+	_ SnippetSearcher = (*SearchModel)(nil)
+	_ UserStore       = (*UserModel)(nil)
+	_ RevisionStore   = (*RevisionModel)(nil)
+	_ TagStore        = (*TagModel)(nil)
+	_ TokenStore      = (*TokenModel)(nil)
+)
+
+// Now returns the current UTC time truncated to whole seconds. Every store
+// stamps records with it so that timestamps compare the same way whether they
+// are held by MySQL, SQLite or in memory.
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// TagCount is a tag with the number of unexpired public snippets that carry
+// it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// Counts returns every tag in use on an unexpired public snippet, in name
+// order.
+func (m *TagModel) Counts() ([]TagCount, error) {
+	query := `SELECT t.name, COUNT(*) FROM tags t
+	INNER JOIN snippet_tags st ON st.tag_id = t.id
+	INNER JOIN snippets s ON s.id = st.snippet_id
+	WHERE s.expires > ? AND s.visibility = ?
+	GROUP BY t.name ORDER BY t.name`
+
+	rows, err := m.DB.Query(query, Now(), VisibilityPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TagCount
+
+	for rows.Next() {
+		var c TagCount
+
+		if err = rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// setTags replaces the tags on a snippet as part of an insert or update; new
+// tag names are created as needed.
+func setTags(tx *sql.Tx, id int, tags []string) error {
+	_, err := tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		tagID, err := tagID(tx, tag)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO snippet_tags (snippet_id, tag_id) VALUES (?, ?)`, id, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagID returns the ID of the named tag, creating the tag if it does not
+// exist yet.
+func tagID(tx *sql.Tx, name string) (int, error) {
+	var id int
+
+	err := tx.QueryRow(`SELECT id FROM tags WHERE name = ?`, name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO tags (name) VALUES (?)`, name)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// snippetTags returns the tags on a snippet in name order.
+func (m *SnippetModel) snippetTags(id int) ([]string, error) {
+	query := `SELECT t.name FROM snippet_tags st
+	INNER JOIN tags t ON t.id = st.tag_id
+	WHERE st.snippet_id = ? ORDER BY t.name`
+
+	rows, err := m.DB.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+
+	for rows.Next() {
+		var tag string
+
+		if err = rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSnippetModelTags(t *testing.T) {
+	db := newTestDB(t)
+	m := &SnippetModel{DB: db}
+	userID := newTestUser(t, db, "alice")
+
+	// Make writing the tag "fail" fail, to check that the rest of the insert
+	// or update is rolled back with it.
+	_, err := db.Exec(`CREATE TRIGGER fail_tag BEFORE INSERT ON tags WHEN NEW.name = 'fail'
+	BEGIN SELECT RAISE(ABORT, 'tag rejected'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := SnippetInput{Title: "Tagged", Content: "Tagged", Visibility: VisibilityPublic, Expires: 7, Tags: []string{"go", "sql"}}
+
+	id, err := m.Insert(userID, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippet, err := m.Get(id, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(snippet.Tags, in.Tags) {
+		t.Fatalf("got tags %q after insert; want %q", snippet.Tags, in.Tags)
+	}
+
+	tests := []struct {
+		name      string
+		title     string
+		tags      []string
+		wantErr   bool
+		wantTitle string
+		wantTags  []string
+	}{
+		{
+			name:      "Replaced",
+			title:     "Retagged",
+			tags:      []string{"web", "go"},
+			wantTitle: "Retagged",
+			wantTags:  []string{"go", "web"},
+		},
+		{
+			name:      "Failed tag rolls back the update",
+			title:     "Never saved",
+			tags:      []string{"rust", "fail"},
+			wantErr:   true,
+			wantTitle: "Retagged",
+			wantTags:  []string{"go", "web"},
+		},
+		{
+			name:      "Removed",
+			title:     "Untagged",
+			tags:      nil,
+			wantTitle: "Untagged",
+			wantTags:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := in
+			in.Title, in.Tags = tt.title, tt.tags
+
+			err := m.Update(id, userID, in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			snippet, err := m.Get(id, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippet.Title != tt.wantTitle || !slices.Equal(snippet.Tags, tt.wantTags) {
+				t.Errorf("got title %q and tags %q; want %q and %q", snippet.Title, snippet.Tags, tt.wantTitle, tt.wantTags)
+			}
+		})
+	}
+
+	t.Run("Failed tag rolls back the insert", func(t *testing.T) {
+		in := in
+		in.Title, in.Tags = "Never saved", []string{"fail"}
+
+		if _, err := m.Insert(userID, in); err == nil {
+			t.Fatal("got no error; want the tag to be rejected")
+		}
+
+		snippets, err := m.ByUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i := slices.IndexFunc(snippets, func(s Snippet) bool { return s.Title == "Never saved" }); i >= 0 {
+			t.Errorf("got snippet %d saved without its tags", snippets[i].ID)
+		}
+	})
+}
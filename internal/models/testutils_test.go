@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/migrations"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB returns a new, fully migrated SQLite database in a temporary
+// directory, opened with the options of the default DSN.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate"
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// newTestUser adds a user directly, skipping the deliberately slow password
+// hashing of UserModel.Insert, and returns their ID.
+func newTestUser(t *testing.T, db *sql.DB, name string) int {
+	t.Helper()
+
+	result, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, '', ?)`,
+		name, name+"@example.com", Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int(id)
+}
+
+// openDeferred opens the database db was opened on again, without
+// _txlock=immediate, so that transactions that read before they write fail
+// with SQLITE_BUSY rather than wait when another writer gets in first.
+func openDeferred(t *testing.T, db *sql.DB) *sql.DB {
+	t.Helper()
+
+	var seq int
+	var name, path string
+	if err := db.QueryRow(`PRAGMA database_list`).Scan(&seq, &name, &path); err != nil {
+		t.Fatal(err)
+	}
+
+	deferred, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { deferred.Close() })
+
+	return deferred
+}
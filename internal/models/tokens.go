@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Token scopes. A read token may only be used for requests that do not change
+// anything; a write token may do everything the owning user can.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// tokenPrefix marks personal API tokens so they are easy to recognise in
+// logs and secret scanners.
+const tokenPrefix = "sbx_"
+
+// Token is a personal API token. Only a SHA-256 hash of the token is stored,
+// so the plaintext is shown to the user once when it is created. LastUsed is
+// the zero time if the token has never been used.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	LastUsed time.Time
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a new token for the user and returns its plaintext.
+func (m *TokenModel) Insert(userID int, name, scope string) (string, error) {
+	plaintext, hash, err := GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO api_tokens (user_id, name, hash, scope, created) VALUES (?, ?, ?, ?, ?)`
+
+	_, err = m.DB.Exec(stmt, userID, name, hash, scope, Now())
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// ForUser returns every token belonging to the user, newest first.
+func (m *TokenModel) ForUser(userID int) ([]Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, last_used FROM api_tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+
+	for rows.Next() {
+		var t Token
+		var lastUsed sql.NullTime
+
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+
+		t.LastUsed = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens. It returns ErrNoRecord if the token
+// does not exist or belongs to somebody else.
+func (m *TokenModel) Revoke(id, userID int) error {
+	stmt := `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Authenticate looks up the token with the given plaintext and records that it
+// has been used. It returns ErrInvalidCredentials if there is no such token.
+func (m *TokenModel) Authenticate(plaintext string) (Token, error) {
+	hash := HashToken(plaintext)
+
+	stmt := `SELECT id, user_id, name, scope, created FROM api_tokens WHERE hash = ?`
+
+	var t Token
+
+	err := m.DB.QueryRow(stmt, hash).Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Token{}, ErrInvalidCredentials
+		} else {
+			return Token{}, err
+		}
+	}
+
+	_, err = m.DB.Exec(`UPDATE api_tokens SET last_used = ? WHERE id = ?`, Now(), t.ID)
+	if err != nil {
+		return Token{}, err
+	}
+
+	return t, nil
+}
+
+// GenerateToken returns a new random token and the hash under which it
+// should be stored.
+func GenerateToken() (plaintext, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	plaintext = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return plaintext, HashToken(plaintext), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of a token's plaintext.
+func HashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
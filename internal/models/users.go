@@ -16,8 +16,16 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	IsAdmin        bool
 }
 
+// AnonymousEmail and AnonymousName identify the account that owns snippets
+// pasted without signing in. Signing up with the email address is refused.
+const (
+	AnonymousEmail = "anonymous@snippetbox.invalid"
+	AnonymousName  = "Anonymous"
+)
+
 type UserModel struct {
 	DB *sql.DB
 }
@@ -27,9 +35,9 @@ func (m *UserModel) Insert(name, email, password string) error {
 	if err != nil {
 		return err
 	}
-	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, ?)`
 
-	_, err = m.DB.Exec(stmt, name, email, hashedPassword)
+	_, err = m.DB.Exec(stmt, name, email, hashedPassword, Now())
 
 	if err != nil {
 		var mySQLError *mysql.MySQLError
@@ -38,12 +46,48 @@ func (m *UserModel) Insert(name, email, password string) error {
 				return ErrDuplicateEmail
 			}
 		}
+		// SQLite reports the violated columns rather than the constraint name.
+		if strings.Contains(err.Error(), "UNIQUE constraint failed: users.email") {
+			return ErrDuplicateEmail
+		}
 		return err
 	}
 
 	return nil
 }
 
+// Anonymous returns the ID of the anonymous account, creating it the first
+// time it is needed. Its password is random and immediately forgotten, so
+// nobody can log in as it.
+func (m *UserModel) Anonymous() (int, error) {
+	var id int
+
+	stmt := `SELECT id FROM users WHERE email = ?`
+
+	err := m.DB.QueryRow(stmt, AnonymousEmail).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	password, _, err := GenerateToken()
+	if err != nil {
+		return 0, err
+	}
+
+	// Another server may create the account at the same time; the unique
+	// email constraint makes sure only one of us does.
+	err = m.Insert(AnonymousName, AnonymousEmail, password)
+	if err != nil && !errors.Is(err, ErrDuplicateEmail) {
+		return 0, err
+	}
+
+	err = m.DB.QueryRow(stmt, AnonymousEmail).Scan(&id)
+	return id, err
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var (
 		id             int
@@ -73,6 +117,30 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	return id, nil
 }
 
+func (m *UserModel) Get(id int) (User, error) {
+	var user User
+
+	stmt := `SELECT id, name, email, created, is_admin FROM users WHERE id = ?`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.IsAdmin)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return user, nil
+}
+
 func (m *UserModel) Exists(id int) (bool, error) {
-	return false, nil
+	var exists bool
+
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ?)`
+
+	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+
+	return exists, err
 }
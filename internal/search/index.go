@@ -0,0 +1,151 @@
+package search
+
+import (
+	"math"
+	"slices"
+	"sync"
+)
+
+// titleWeight is how many times a term in a title counts compared with the
+// same term in the content.
+const titleWeight = 3
+
+// BM25 tuning parameters, at their customary values.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Hit is a document matched by Index.Search.
+type Hit struct {
+	ID    int
+	Score float64
+}
+
+// Index is an inverted index over snippet titles and content, ranking matches
+// with BM25. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[int]int // term -> document ID -> weighted frequency
+	docs     map[int]document
+	total    int // sum of document lengths
+}
+
+// document records what Add indexed for a document, so that it can be removed
+// again without scanning every posting list.
+type document struct {
+	length int // weighted number of terms
+	terms  []string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int]int),
+		docs:     make(map[int]document),
+	}
+}
+
+// Add indexes a document, replacing any earlier version with the same ID.
+func (idx *Index) Add(id int, title, content string) {
+	freqs := make(map[string]int)
+	length := 0
+
+	for _, t := range tokenize(title) {
+		freqs[t.term] += titleWeight
+		length += titleWeight
+	}
+	for _, t := range tokenize(content) {
+		freqs[t.term]++
+		length++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+
+	doc := document{length: length, terms: make([]string, 0, len(freqs))}
+	for term, n := range freqs {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[int]int)
+		}
+		idx.postings[term][id] = n
+		doc.terms = append(doc.terms, term)
+	}
+	idx.docs[id] = doc
+	idx.total += length
+}
+
+// Remove drops a document from the index.
+func (idx *Index) Remove(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// remove drops a document from the index. The caller must hold the write lock.
+func (idx *Index) remove(id int) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, id)
+	idx.total -= doc.length
+}
+
+// Search returns every document containing at least one of terms, best match
+// first. Equal scores are ordered newest (highest ID) first.
+func (idx *Index) Search(terms []string) []Hit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	if n == 0 {
+		return nil
+	}
+	avgLength := float64(idx.total) / n
+
+	scores := make(map[int]float64)
+
+	for _, term := range terms {
+		docs := idx.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+
+		df := float64(len(docs))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for id, freq := range docs {
+			tf := float64(freq)
+			norm := k1 * (1 - b + b*float64(idx.docs[id].length)/avgLength)
+			scores[id] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+
+	slices.SortFunc(hits, func(a, b Hit) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		default:
+			return b.ID - a.ID
+		}
+	})
+
+	return hits
+}
@@ -0,0 +1,148 @@
+// Package search provides the pieces of full-text search that do not depend
+// on a database: splitting text into terms, an in-process inverted index for
+// the stores that have no full-text support of their own, and highlighting of
+// matched terms in titles and excerpts.
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// token is a term found in a piece of text, with its byte offsets.
+type token struct {
+	term       string
+	start, end int
+}
+
+// isWordRune reports whether r can be part of a term. Underscores count so
+// that identifiers such as snake_case names are indexed whole.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokenize splits text into lower-cased terms.
+func tokenize(text string) []token {
+	var tokens []token
+
+	start := -1
+	for i, r := range text {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+
+	return tokens
+}
+
+// Terms returns the distinct terms of a search query, in the order they first
+// appear.
+func Terms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+
+	for _, t := range tokenize(query) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+
+	return terms
+}
+
+// Fragment is a piece of highlighted text. Match is set on fragments that are
+// one of the search terms. Templates render fragments individually so that the
+// text is escaped as usual and only the highlighting markup is trusted.
+type Fragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// Highlight splits text into fragments, marking every occurrence of terms.
+func Highlight(text string, terms []string) []Fragment {
+	want := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		want[term] = true
+	}
+
+	var fragments []Fragment
+	last := 0
+
+	for _, t := range tokenize(text) {
+		if !want[t.term] {
+			continue
+		}
+		if t.start > last {
+			fragments = append(fragments, Fragment{Text: text[last:t.start]})
+		}
+		fragments = append(fragments, Fragment{Text: text[t.start:t.end], Match: true})
+		last = t.end
+	}
+
+	if last < len(text) {
+		fragments = append(fragments, Fragment{Text: text[last:]})
+	}
+
+	return fragments
+}
+
+// Excerpt returns a highlighted passage of about width characters from text,
+// centred on the first match of terms. If nothing matches, the excerpt is
+// taken from the start of the text. Elided text is marked with an ellipsis.
+func Excerpt(text string, terms []string, width int) []Fragment {
+	want := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		want[term] = true
+	}
+
+	first := 0
+	for _, t := range tokenize(text) {
+		if want[t.term] {
+			first = t.start
+			break
+		}
+	}
+
+	// Start a third of the way back from the first match, then widen to
+	// whole words.
+	start := first
+	for n := 0; start > 0 && n < width/3; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; end < len(text) && n < width; n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+
+	if start > 0 {
+		if i := strings.IndexFunc(text[start:first], unicode.IsSpace); i >= 0 {
+			start += i + 1
+		}
+	}
+	if end < len(text) {
+		if i := strings.LastIndexFunc(text[first:end], unicode.IsSpace); i >= 0 {
+			end = first + i
+		}
+	}
+
+	passage := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		passage = "…" + passage
+	}
+	if end < len(text) {
+		passage += "…"
+	}
+
+	return Highlight(passage, terms)
+}
@@ -0,0 +1,237 @@
+package search
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+)
+
+// IndexedStore wraps a SnippetStore that has no full-text search of its own.
+// It keeps an Index in step with every write made through it and answers
+// searches from the index, loading the matching snippets from the store. It
+// also remembers when each indexed snippet expires, so that searches can
+// leave out expired snippets without loading them, and only load the page of
+// snippets asked for.
+//
+// Only public snippets without a passphrase are indexed, as only they may be
+// found by searching. The index lives in process memory, so it only sees
+// writes made by this process. That suits the memory store and a single
+// server on SQLite.
+type IndexedStore struct {
+	models.SnippetStore
+	index *Index
+
+	mu      sync.Mutex
+	expires map[int]time.Time // indexed snippet ID -> when it expires
+}
+
+// NewIndexedStore wraps store and indexes the unexpired public snippets it
+// already holds, except those protected by a passphrase.
+func NewIndexedStore(store models.SnippetStore) (*IndexedStore, error) {
+	s := &IndexedStore{SnippetStore: store, index: NewIndex(), expires: make(map[int]time.Time)}
+
+	opts := models.ListOptions{Page: 1, PageSize: 100, Sort: models.SortOldest}
+
+	for {
+		snippets, total, err := store.List(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, snippet := range snippets {
+			if searchable(snippet) {
+				s.addDocument(snippet.ID, snippet.Title, snippet.Content, snippet.Expires)
+			}
+		}
+
+		if opts.Page*opts.PageSize >= total {
+			return s, nil
+		}
+		opts.Page++
+	}
+}
+
+func (s *IndexedStore) Insert(userID int, in models.SnippetInput) (int, error) {
+	id, err := s.SnippetStore.Insert(userID, in)
+	if err != nil {
+		return 0, err
+	}
+
+	s.add(id, in)
+
+	return id, nil
+}
+
+func (s *IndexedStore) Update(id, userID int, in models.SnippetInput) error {
+	err := s.SnippetStore.Update(id, userID, in)
+	if err != nil {
+		return err
+	}
+
+	// The snippet may keep a passphrase the input doesn't mention, so load it
+	// back rather than indexing the input.
+	return s.reindex(id)
+}
+
+func (s *IndexedStore) Restore(id, userID, revision int) error {
+	err := s.SnippetStore.Restore(id, userID, revision)
+	if err != nil {
+		return err
+	}
+
+	return s.reindex(id)
+}
+
+func (s *IndexedStore) SetPassphrase(id int, passphrase string) error {
+	err := s.SnippetStore.SetPassphrase(id, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return s.reindex(id)
+}
+
+func (s *IndexedStore) Burn(id int) (models.Snippet, error) {
+	snippet, err := s.SnippetStore.Burn(id)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+
+	s.remove(id)
+
+	return snippet, nil
+}
+
+func (s *IndexedStore) Delete(id int) error {
+	err := s.SnippetStore.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	s.remove(id)
+
+	return nil
+}
+
+// addDocument indexes a snippet and records when it expires.
+func (s *IndexedStore) addDocument(id int, title, content string, expires time.Time) {
+	s.mu.Lock()
+	s.expires[id] = expires
+	s.mu.Unlock()
+
+	s.index.Add(id, title, content)
+}
+
+// remove drops a snippet from the index.
+func (s *IndexedStore) remove(id int) {
+	s.mu.Lock()
+	delete(s.expires, id)
+	s.mu.Unlock()
+
+	s.index.Remove(id)
+}
+
+// searchable reports whether a snippet that an anonymous visitor can load
+// belongs in the index. Matching the content of a snippet protected by a
+// passphrase would give it away, and encrypted content can't be matched.
+func searchable(snippet models.Snippet) bool {
+	return !snippet.Protected() && !snippet.Encrypted
+}
+
+// add indexes a snippet that has just been inserted, unless it is not public,
+// is protected by a passphrase or is encrypted.
+func (s *IndexedStore) add(id int, in models.SnippetInput) {
+	if in.Visibility != models.VisibilityPublic || in.Passphrase != "" || in.Encrypted {
+		s.remove(id)
+		return
+	}
+
+	s.addDocument(id, in.Title, in.Content, models.Now().AddDate(0, 0, in.Expires))
+}
+
+// reindex reloads a snippet from the store and indexes it again. Snippets
+// that can't be loaded by an anonymous visitor are not public, so they are
+// removed instead, as are snippets that aren't searchable.
+func (s *IndexedStore) reindex(id int) error {
+	snippet, err := s.SnippetStore.Get(id, 0)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			s.remove(id)
+			return nil
+		}
+		return err
+	}
+
+	if !searchable(snippet) {
+		s.remove(id)
+		return nil
+	}
+
+	s.addDocument(snippet.ID, snippet.Title, snippet.Content, snippet.Expires)
+
+	return nil
+}
+
+// Search ranks the indexed snippets against query and loads the requested
+// page of them. Expired snippets are dropped from the index before paging.
+// Snippets on the page that can no longer be found by an anonymous visitor,
+// which can only happen if they were changed without going through s, are
+// dropped as they are found and left out of the page and the total.
+func (s *IndexedStore) Search(query string, page, pageSize int) ([]models.SearchResult, int, error) {
+	hits := s.live(s.index.Search(Terms(query)))
+	total := len(hits)
+
+	start := min((page-1)*pageSize, len(hits))
+	end := min(start+pageSize, len(hits))
+
+	var results []models.SearchResult
+
+	for _, hit := range hits[start:end] {
+		snippet, err := s.SnippetStore.Get(hit.ID, 0)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			return nil, 0, err
+		}
+
+		if err != nil || !searchable(snippet) {
+			s.remove(hit.ID)
+			total--
+			continue
+		}
+
+		results = append(results, models.SearchResult{Snippet: snippet, Score: hit.Score})
+	}
+
+	return results, total, nil
+}
+
+// live returns the hits that have not expired, in the same order, and drops
+// the expired ones from the index.
+func (s *IndexedStore) live(hits []Hit) []Hit {
+	now := models.Now()
+
+	var live []Hit
+	var expired []int
+
+	s.mu.Lock()
+	for _, hit := range hits {
+		if s.expires[hit.ID].After(now) {
+			live = append(live, hit)
+		} else {
+			expired = append(expired, hit.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range expired {
+		s.remove(id)
+	}
+
+	return live
+}
+
+var (
+	_ models.SnippetStore    = (*IndexedStore)(nil)
+	_ models.SnippetSearcher = (*IndexedStore)(nil)
+)
@@ -0,0 +1,93 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fayazp088/snippet-box/internal/models"
+	"github.com/fayazp088/snippet-box/internal/models/memory"
+)
+
+// countingStore counts the snippets loaded through Get.
+type countingStore struct {
+	models.SnippetStore
+	gets int
+}
+
+func (s *countingStore) Get(id, viewerID int) (models.Snippet, error) {
+	s.gets++
+	return s.SnippetStore.Get(id, viewerID)
+}
+
+func TestIndexedStoreSearch(t *testing.T) {
+	store := &countingStore{SnippetStore: &memory.SnippetModel{DB: memory.New(), SlugLength: models.DefaultSlugLength}}
+
+	s, err := NewIndexedStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for i := 0; i < 25; i++ {
+		id, err := s.Insert(1, models.SnippetInput{
+			Title:      fmt.Sprintf("Snippet %d", i),
+			Content:    "fmt.Println(greeting)",
+			Visibility: models.VisibilityPublic,
+			Expires:    7,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Expire two snippets behind the store's back. They are dropped without
+	// being loaded.
+	s.mu.Lock()
+	s.expires[ids[0]] = models.Now()
+	s.expires[ids[1]] = models.Now().AddDate(0, 0, -1)
+	s.mu.Unlock()
+
+	// Delete the oldest of the rest behind the store's back too. Ties are
+	// ranked newest first, so it is only found to be missing when the last
+	// page is loaded.
+	if err := store.SnippetStore.Delete(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		page      int
+		wantCount int
+		wantTotal int
+	}{
+		{"First page", 1, 10, 23},
+		{"Last page", 3, 2, 22},
+		{"Past the end", 4, 0, 22},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.gets = 0
+
+			results, total, err := s.Search("println", tt.page, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != tt.wantCount {
+				t.Errorf("got %d results; want %d", len(results), tt.wantCount)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("got total %d; want %d", total, tt.wantTotal)
+			}
+			if store.gets > 10 {
+				t.Errorf("got %d snippets loaded; want at most 10", store.gets)
+			}
+			for _, r := range results {
+				if r.ID == ids[0] || r.ID == ids[1] || r.ID == ids[2] {
+					t.Errorf("got snippet %d, which should not be found", r.ID)
+				}
+			}
+		})
+	}
+}
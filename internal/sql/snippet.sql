@@ -1,8 +0,0 @@
-CREATE TABLE snippets (
-id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT, title VARCHAR(100) NOT NULL,
-content TEXT NOT NULL,
-created DATETIME NOT NULL,
-expires DATETIME NOT NULL
-);
-
-CREATE INDEX idx_snippets_created ON snippets(created);
\ No newline at end of file
@@ -4,11 +4,21 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])? (?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// TagRX matches a normalized tag: lowercase letters and digits plus the
+// punctuation found in names like c++, c#, node.js and ci-cd.
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#.-]*$`)
+
+// CiphertextRX matches snippet content encrypted in the browser with
+// AES-256-GCM: a version, then the base64url encoded 12-byte IV and the
+// ciphertext with its 16-byte tag.
+var CiphertextRX = regexp.MustCompile(`^v1:[A-Za-z0-9_-]{16}:[A-Za-z0-9_-]{22,}$`)
+
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
@@ -49,6 +59,10 @@ func PermittedValue[T comparable](value T, permittedValues ...T) bool {
 	return slices.Contains(permittedValues, value)
 }
 
+func MaxItems[T any](values []T, n int) bool {
+	return len(values) <= n
+}
+
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }
@@ -56,3 +70,12 @@ func MinChars(value string, n int) bool {
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// DateLayout is the layout of dates accepted by ValidDate, matching the value
+// of an HTML date input.
+const DateLayout = "2006-01-02"
+
+func ValidDate(value string) bool {
+	_, err := time.Parse(DateLayout, value)
+	return err == nil
+}
@@ -0,0 +1,40 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCiphertextRX(t *testing.T) {
+	iv := "AAECAwQFBgcICQoL"
+	ciphertext := "3q2-7w_mYWJjZGVmZ2hpams"
+
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"Valid", "v1:" + iv + ":" + ciphertext, true},
+		{"Long ciphertext", "v1:" + iv + ":" + strings.Repeat("A", 4096), true},
+		{"Plain text", "echo hello", false},
+		{"Empty", "", false},
+		{"Unknown version", "v2:" + iv + ":" + ciphertext, false},
+		{"Missing IV", "v1::" + ciphertext, false},
+		{"Short IV", "v1:" + iv[:15] + ":" + ciphertext, false},
+		{"Long IV", "v1:" + iv + "A:" + ciphertext, false},
+		{"Ciphertext shorter than the GCM tag", "v1:" + iv + ":" + ciphertext[:21], false},
+		{"Standard base64", "v1:" + iv + ":" + "3q2+7w/mYWJjZGVmZ2hpams", false},
+		{"Padding", "v1:" + iv + ":" + ciphertext + "=", false},
+		{"Trailing newline", "v1:" + iv + ":" + ciphertext + "\n", false},
+		{"Text after", "v1:" + iv + ":" + ciphertext + " <script>", false},
+		{"Text before", "x v1:" + iv + ":" + ciphertext, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(tt.value, CiphertextRX); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Encrypted snippets are encrypted and decrypted here, in the browser, so that
+// the server only ever sees ciphertext. The key is kept in the fragment of the
+// snippet's link (the part after the #), which browsers never send to the
+// server. Content is encrypted with AES-256-GCM and stored as
+// "v1:<iv>:<ciphertext>", both parts base64url encoded; the server checks
+// that shape with validator.CiphertextRX.
+(function () {
+	var version = "v1";
+	var ciphertextRX = /^v1:[A-Za-z0-9_-]{16}:[A-Za-z0-9_-]{22,}$/;
+	var keyRX = /^[A-Za-z0-9_-]{43}$/;
+
+	function toBase64URL(bytes) {
+		var binary = "";
+		for (var i = 0; i < bytes.length; i++) {
+			binary += String.fromCharCode(bytes[i]);
+		}
+		return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+	}
+
+	function fromBase64URL(text) {
+		var base64 = text.replace(/-/g, "+").replace(/_/g, "/");
+		while (base64.length % 4) {
+			base64 += "=";
+		}
+		var binary = atob(base64);
+		var bytes = new Uint8Array(binary.length);
+		for (var i = 0; i < binary.length; i++) {
+			bytes[i] = binary.charCodeAt(i);
+		}
+		return bytes;
+	}
+
+	// fragmentKey returns the base64url encoded key in the page's fragment, or
+	// null if there isn't one.
+	function fragmentKey() {
+		var key = window.location.hash.slice(1);
+		return keyRX.test(key) ? key : null;
+	}
+
+	function importKey(key) {
+		return crypto.subtle.importKey("raw", fromBase64URL(key), "AES-GCM", false, ["encrypt", "decrypt"]);
+	}
+
+	// newKey generates a random key, resolving to it base64url encoded.
+	function newKey() {
+		return crypto.subtle.generateKey({ name: "AES-GCM", length: 256 }, true, ["encrypt", "decrypt"])
+			.then(function (key) {
+				return crypto.subtle.exportKey("raw", key);
+			})
+			.then(function (raw) {
+				return toBase64URL(new Uint8Array(raw));
+			});
+	}
+
+	function encrypt(key, plaintext) {
+		var iv = crypto.getRandomValues(new Uint8Array(12));
+		return importKey(key)
+			.then(function (cryptoKey) {
+				return crypto.subtle.encrypt({ name: "AES-GCM", iv: iv }, cryptoKey, new TextEncoder().encode(plaintext));
+			})
+			.then(function (ciphertext) {
+				return version + ":" + toBase64URL(iv) + ":" + toBase64URL(new Uint8Array(ciphertext));
+			});
+	}
+
+	function decrypt(key, content) {
+		var parts = content.split(":");
+		if (parts.length !== 3 || parts[0] !== version) {
+			return Promise.reject(new Error("unknown format"));
+		}
+		return importKey(key)
+			.then(function (cryptoKey) {
+				return crypto.subtle.decrypt({ name: "AES-GCM", iv: fromBase64URL(parts[1]) }, cryptoKey, fromBase64URL(parts[2]));
+			})
+			.then(function (plaintext) {
+				return new TextDecoder().decode(plaintext);
+			});
+	}
+
+	// Links and forms that lead back to the snippet carry the key along, as
+	// redirects keep the fragment of the URL they answer.
+	function keepFragment() {
+		if (!fragmentKey()) {
+			return;
+		}
+		var elements = document.querySelectorAll("[data-keep-fragment]");
+		for (var i = 0; i < elements.length; i++) {
+			var attribute = elements[i].tagName === "FORM" ? "action" : "href";
+			var url = elements[i].getAttribute(attribute).split("#")[0];
+			elements[i].setAttribute(attribute, url + window.location.hash);
+		}
+	}
+
+	// showSnippet decrypts the content of the snippet page.
+	function showSnippet(container) {
+		var status = container.querySelector(".status");
+		var pre = container.querySelector("pre");
+
+		var key = fragmentKey();
+		if (!key) {
+			status.textContent = "This snippet is encrypted, and the link you followed has no key to decrypt it. Ask for the full link, including the part after the #.";
+			return;
+		}
+
+		decrypt(key, container.getAttribute("data-ciphertext"))
+			.then(function (plaintext) {
+				pre.textContent = plaintext;
+				pre.hidden = false;
+				status.hidden = true;
+			})
+			.catch(function () {
+				status.textContent = "This snippet could not be decrypted. Check that the link is complete.";
+			});
+	}
+
+	// setUpForm encrypts the content of the create or edit form as it is
+	// submitted, and decrypts content the server sends back into it.
+	function setUpForm(form) {
+		var toggle = form.querySelector("input[name=encrypted]");
+		var content = form.querySelector("textarea[name=content]");
+		var preview = form.querySelector("button.preview");
+		var note = form.querySelector(".encrypt .hint");
+
+		form.querySelector(".encrypt").hidden = false;
+
+		function update() {
+			if (preview) {
+				preview.disabled = toggle.checked;
+			}
+		}
+		toggle.addEventListener("change", update);
+		update();
+
+		var key = fragmentKey();
+
+		if (toggle.checked && ciphertextRX.test(content.value)) {
+			content.readOnly = true;
+			if (key) {
+				decrypt(key, content.value).then(function (plaintext) {
+					content.value = plaintext;
+					content.readOnly = false;
+				}, function () {
+					note.textContent = "The key in the link doesn't decrypt this snippet, so its content can't be changed.";
+				});
+			} else {
+				note.textContent = "Open this page from the snippet's full link to change its content.";
+			}
+		}
+
+		form.addEventListener("submit", function (event) {
+			// Leave content that couldn't be decrypted as it is.
+			if (!toggle.checked || content.readOnly) {
+				return;
+			}
+			event.preventDefault();
+
+			Promise.resolve(key || newKey())
+				.then(function (k) {
+					key = k;
+					return encrypt(key, content.value);
+				})
+				.then(function (ciphertext) {
+					var field = document.createElement("input");
+					field.type = "hidden";
+					field.name = "content";
+					field.value = ciphertext;
+					form.appendChild(field);
+					content.removeAttribute("name");
+
+					form.action = form.getAttribute("action").split("#")[0] + "#" + key;
+					form.submit();
+				})
+				.catch(function () {
+					note.textContent = "Your browser could not encrypt the snippet.";
+				});
+		});
+	}
+
+	keepFragment();
+
+	var container = document.querySelector(".encrypted[data-ciphertext]");
+	if (container) {
+		showSnippet(container);
+	}
+
+	var form = document.querySelector("form[data-encryptable]");
+	if (form && window.crypto && crypto.subtle) {
+		setUpForm(form);
+	}
+})();